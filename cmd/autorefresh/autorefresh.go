@@ -0,0 +1,147 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/target"
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+var arguments struct {
+	hostAddress,
+	targetName,
+	dataDir,
+	command string
+	interval,
+	debounce,
+	timeout time.Duration
+	resources bool
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Printf("Usage: autorefresh [options] <compiled data directory>\n\n")
+		flag.PrintDefaults()
+	}
+
+	flag.StringVar(&arguments.hostAddress, "host", "", "host address, address:[port] (default localhost, or the host of -target)")
+	flag.StringVar(&arguments.targetName, "target", "", "named target from "+target.DefaultPath())
+	flag.StringVar(&arguments.command, "command", "refresh", "console command sent on changes")
+	flag.DurationVar(&arguments.interval, "interval", 250*time.Millisecond, "directory polling interval")
+	flag.DurationVar(&arguments.debounce, "debounce", time.Second, "wait for changes to settle before refreshing")
+	flag.BoolVar(&arguments.resources, "resources", true, "pass changed resources as command arguments")
+	flag.DurationVar(&arguments.timeout, "timeout", 0, "disconnect unresponsive engines after this time, 0 to disable")
+}
+
+func errorln(msg ...interface{}) {
+	fmt.Fprintln(os.Stderr, msg...)
+	os.Exit(-1)
+}
+
+func assertln(err error, msg ...interface{}) {
+	if err != nil {
+		errorln(msg...)
+	}
+}
+
+// resourceArgs returns the type and name of each changed file as separate
+// arguments. It returns false if a file has no extension, such as hash named
+// compiled data, since its type is unknown.
+func resourceArgs(changed []string) ([]sjson.Value, bool) {
+	args := make([]sjson.Value, 0, len(changed)*2)
+	for _, file := range changed {
+		ext := path.Ext(file)
+		name := strings.TrimSuffix(file, ext)
+		if ext == "" || name == "" || strings.HasSuffix(name, "/") {
+			return nil, false
+		}
+		args = append(args, strings.TrimPrefix(ext, "."), name)
+	}
+	return args, true
+}
+
+// refresh sends the command with the changed resources, or without arguments
+// to refresh everything if the resources are unknown.
+func refresh(con *console.Console, changed []string) error {
+	var args []sjson.Value
+	if arguments.resources {
+		var ok bool
+		if args, ok = resourceArgs(changed); !ok {
+			fmt.Println("  unknown resource types, refreshing everything")
+		}
+	}
+	return con.SendCommandArgs(arguments.command, args...)
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(-1)
+	}
+	arguments.dataDir = flag.Arg(0)
+
+	fmt.Println("Stingray Auto Refresh")
+	fmt.Printf("Copyright (C) 2016 Andreas T Jonsson\n\n")
+
+	w, err := newWatcher(arguments.dataDir)
+	assertln(err, err)
+
+	tgt, err := target.FromFlags(arguments.targetName, arguments.hostAddress)
+	assertln(err, err)
+	fmt.Printf("connecting to %s...\n", tgt.Address())
+	con, err := tgt.Connect()
+	assertln(err, "could not connect to: "+tgt.Address())
+	defer con.Close()
+	con.SetHeartbeatTimeout(arguments.timeout)
+
+	fmt.Printf("watching %s\n", arguments.dataDir)
+
+	go func() {
+		for {
+			msg, err := con.ReceiveMessage()
+			assertln(err, err)
+			fmt.Printf("%s %v\n", msg.Time.Format("15:04:05"), msg)
+		}
+	}()
+
+	batches := make(chan []string)
+	errors := make(chan error)
+	go w.watch(arguments.interval, arguments.debounce, batches, errors)
+
+	for {
+		select {
+		case changed := <-batches:
+			fmt.Printf("%s %d changed, sending %s\n", time.Now().Format("15:04:05"), len(changed), arguments.command)
+			for _, file := range changed {
+				fmt.Println("  " + file)
+			}
+			assertln(refresh(con, changed), "could not send refresh command")
+		case err := <-errors:
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
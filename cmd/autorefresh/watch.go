@@ -0,0 +1,157 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// watcher polls a directory tree for added, modified and removed files.
+type watcher struct {
+	root  string
+	files map[string]fileState
+}
+
+func (w *watcher) scan() (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	err := filepath.Walk(w.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			rel, err := filepath.Rel(w.root, path)
+			if err != nil {
+				return err
+			}
+			files[filepath.ToSlash(rel)] = fileState{info.ModTime(), info.Size()}
+		}
+		return nil
+	})
+	return files, err
+}
+
+// poll returns the files that were added or modified, and the files that
+// were removed, since the previous poll. A renamed file is removed under its
+// old name and added under the new.
+func (w *watcher) poll() (changed, removed []string, err error) {
+	files, err := w.scan()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for path, state := range files {
+		if old, ok := w.files[path]; !ok || old != state {
+			changed = append(changed, path)
+		}
+	}
+	for path := range w.files {
+		if _, ok := files[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+
+	w.files = files
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return changed, removed, nil
+}
+
+// debouncer collects changed files into a batch, which is released once no
+// changes have been seen for the debounce duration.
+type debouncer struct {
+	debounce   time.Duration
+	pending    map[string]bool
+	lastChange time.Time
+}
+
+// add records changes seen at now. Removed files are dropped from the batch,
+// since they can not be refreshed.
+func (d *debouncer) add(now time.Time, changed, removed []string) {
+	if len(changed) == 0 && len(removed) == 0 {
+		return
+	}
+
+	d.lastChange = now
+	for _, path := range changed {
+		d.pending[path] = true
+	}
+	for _, path := range removed {
+		delete(d.pending, path)
+	}
+}
+
+// batch returns the pending files, sorted, if they have settled at now.
+func (d *debouncer) batch(now time.Time) []string {
+	if len(d.pending) == 0 || now.Sub(d.lastChange) < d.debounce {
+		return nil
+	}
+
+	batch := make([]string, 0, len(d.pending))
+	for path := range d.pending {
+		batch = append(batch, path)
+	}
+	sort.Strings(batch)
+
+	d.pending = make(map[string]bool)
+	return batch
+}
+
+func newDebouncer(debounce time.Duration) *debouncer {
+	return &debouncer{debounce: debounce, pending: make(map[string]bool)}
+}
+
+// watch sends batches of changed files. A batch is sent once no new
+// changes have been seen for the debounce duration.
+func (w *watcher) watch(interval, debounce time.Duration, batches chan<- []string, errors chan<- error) {
+	d := newDebouncer(debounce)
+
+	for now := range time.Tick(interval) {
+		changed, removed, err := w.poll()
+		if err != nil {
+			errors <- err
+			continue
+		}
+
+		d.add(now, changed, removed)
+		if batch := d.batch(now); batch != nil {
+			batches <- batch
+		}
+	}
+}
+
+func newWatcher(root string) (*watcher, error) {
+	w := &watcher{root: root}
+	files, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	w.files = files
+	return w, nil
+}
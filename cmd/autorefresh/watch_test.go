@@ -0,0 +1,120 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+func TestDebouncer(t *testing.T) {
+	start := time.Unix(1000, 0)
+	d := newDebouncer(time.Second)
+
+	d.add(start, []string{"b.unit", "a.lua"}, nil)
+	if batch := d.batch(start.Add(500 * time.Millisecond)); batch != nil {
+		t.Fatalf("batch released early: %v", batch)
+	}
+
+	// New changes restart the debounce period.
+	d.add(start.Add(900*time.Millisecond), []string{"c.texture", "a.lua"}, []string{"b.unit"})
+	if batch := d.batch(start.Add(1500 * time.Millisecond)); batch != nil {
+		t.Fatalf("batch released early: %v", batch)
+	}
+
+	batch := d.batch(start.Add(1900 * time.Millisecond))
+	if !reflect.DeepEqual(batch, []string{"a.lua", "c.texture"}) {
+		t.Fatalf("unexpected batch: %v", batch)
+	}
+	if batch := d.batch(start.Add(5 * time.Second)); batch != nil {
+		t.Errorf("batch released twice: %v", batch)
+	}
+
+	// A batch of only removed files is never released.
+	d.add(start.Add(6*time.Second), nil, []string{"a.lua"})
+	if batch := d.batch(start.Add(10 * time.Second)); batch != nil {
+		t.Errorf("unexpected batch: %v", batch)
+	}
+}
+
+func TestWatcherPoll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "autorefresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, data string) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("old.lua", "a")
+	write("units/box.unit", "a")
+
+	w, err := newWatcher(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write("units/box.unit", "ab")
+	write("new.lua", "a")
+	if err := os.Rename(filepath.Join(dir, "old.lua"), filepath.Join(dir, "renamed.lua")); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, removed, err := w.poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changed, []string{"new.lua", "renamed.lua", "units/box.unit"}) {
+		t.Errorf("unexpected changes: %v", changed)
+	}
+	if !reflect.DeepEqual(removed, []string{"old.lua"}) {
+		t.Errorf("unexpected removals: %v", removed)
+	}
+
+	if changed, removed, _ := w.poll(); len(changed) != 0 || len(removed) != 0 {
+		t.Errorf("unexpected changes: %v %v", changed, removed)
+	}
+}
+
+func TestResourceArgs(t *testing.T) {
+	args, ok := resourceArgs([]string{"units/box.unit", "script/boot.lua"})
+	expected := []sjson.Value{"unit", "units/box", "lua", "script/boot"}
+	if !ok || !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected arguments: %v", args)
+	}
+
+	for _, file := range []string{"0a1b2c3d4e5f", "data/.hidden"} {
+		if _, ok := resourceArgs([]string{"units/box.unit", file}); ok {
+			t.Errorf("expected unknown type: %s", file)
+		}
+	}
+}
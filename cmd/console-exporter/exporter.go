@@ -0,0 +1,179 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/target"
+)
+
+var metricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+type gaugeFlags []gaugeRule
+
+func (g *gaugeFlags) String() string {
+	var rules []string
+	for _, r := range *g {
+		rules = append(rules, r.name+"="+r.re.String())
+	}
+	return strings.Join(rules, ",")
+}
+
+func (g *gaugeFlags) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return errors.New("expected name=regexp")
+	}
+
+	name := s[:i]
+	if !metricName.MatchString(name) {
+		return fmt.Errorf("invalid metric name: %s", name)
+	}
+
+	re, err := regexp.Compile(s[i+1:])
+	if err != nil {
+		return err
+	}
+	if re.NumSubexp() < 1 {
+		return errors.New("expression needs a capture group for the value")
+	}
+
+	*g = append(*g, gaugeRule{name, re})
+	return nil
+}
+
+var arguments struct {
+	hostList,
+	targetName,
+	listenAddress string
+	retry,
+	timeout time.Duration
+	gauges gaugeFlags
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Printf("Usage: console-exporter [options]\n\n")
+		flag.PrintDefaults()
+	}
+
+	flag.StringVar(&arguments.hostList, "hosts", "localhost", "comma separated host addresses")
+	flag.StringVar(&arguments.targetName, "target", "", "named target from "+target.DefaultPath())
+	flag.StringVar(&arguments.listenAddress, "listen", ":9141", "address to serve metrics on")
+	flag.DurationVar(&arguments.retry, "retry", 5*time.Second, "reconnect interval")
+	flag.DurationVar(&arguments.timeout, "timeout", 0, "disconnect unresponsive engines after this time, 0 to disable")
+	flag.Var(&arguments.gauges, "gauge", "extract a gauge named "+gaugePrefix+"<name> from messages, name=regexp with one capture group (repeatable)")
+}
+
+func errorln(msg ...interface{}) {
+	fmt.Fprintln(os.Stderr, msg...)
+	os.Exit(-1)
+}
+
+func hosts() []string {
+	if arguments.targetName != "" {
+		tgt, err := target.Resolve(arguments.targetName)
+		if err != nil {
+			errorln(err)
+		}
+		return []string{tgt.Address()}
+	}
+
+	var list []string
+	for _, host := range strings.Split(arguments.hostList, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			list = append(list, host)
+		}
+	}
+	return list
+}
+
+func collect(m *metrics, con *console.Console) error {
+	host := con.Host()
+	for {
+		msg, err := con.ReceiveMessage()
+		if err != nil {
+			return err
+		}
+
+		m.count(labels{host, msg.System, msg.Level.String()})
+
+		for _, rule := range arguments.gauges {
+			if match := rule.re.FindStringSubmatch(msg.Message); match != nil {
+				if v, err := strconv.ParseFloat(match[1], 64); err == nil {
+					m.set(rule.name, labels{host: host, system: msg.System}, v)
+				}
+			}
+		}
+	}
+}
+
+func monitor(m *metrics, host string) {
+	for {
+		m.setUp(host, false)
+
+		con, err := console.NewConsole(host, "")
+		if err != nil {
+			log.Printf("%s: %v\n", host, err)
+			time.Sleep(arguments.retry)
+			continue
+		}
+
+		log.Printf("%s: connected\n", host)
+		con.SetHeartbeatTimeout(arguments.timeout)
+		m.setUp(host, true)
+
+		err = collect(m, con)
+		con.Close()
+
+		log.Printf("%s: %v\n", host, err)
+		time.Sleep(arguments.retry)
+	}
+}
+
+func main() {
+	flag.Parse()
+	fmt.Println("Stingray Console Exporter")
+	fmt.Printf("Copyright (C) 2016 Andreas T Jonsson\n\n")
+
+	m := newMetrics()
+	for _, host := range hosts() {
+		go monitor(m, host)
+	}
+
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		m.writeTo(w)
+	})
+
+	log.Println("serving metrics on", arguments.listenAddress)
+	if err := http.ListenAndServe(arguments.listenAddress, nil); err != nil {
+		errorln(err)
+	}
+}
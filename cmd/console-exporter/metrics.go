@@ -0,0 +1,146 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gaugePrefix namespaces gauges extracted from engine messages, so they
+// cannot collide with the metrics of the exporter itself.
+const gaugePrefix = "stingray_engine_"
+
+type gaugeRule struct {
+	name string
+	re   *regexp.Regexp
+}
+
+type labels struct {
+	host,
+	system,
+	level string
+}
+
+type series struct {
+	name   string
+	labels labels
+}
+
+type metrics struct {
+	lock     sync.Mutex
+	counters map[labels]uint64
+	gauges   map[series]float64
+	up       map[string]bool
+}
+
+func (m *metrics) count(l labels) {
+	m.lock.Lock()
+	m.counters[l]++
+	m.lock.Unlock()
+}
+
+func (m *metrics) set(name string, l labels, v float64) {
+	m.lock.Lock()
+	m.gauges[series{name, l}] = v
+	m.lock.Unlock()
+}
+
+func (m *metrics) setUp(host string, up bool) {
+	m.lock.Lock()
+	m.up[host] = up
+	m.lock.Unlock()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (l labels) String() string {
+	var pairs []string
+	for _, p := range [][2]string{{"host", l.host}, {"system", l.system}, {"level", l.level}} {
+		if p[1] != "" {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, p[0], labelEscaper.Replace(p[1])))
+		}
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// writeTo writes all metrics in the Prometheus text exposition format.
+func (m *metrics) writeTo(w io.Writer) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	fmt.Fprintln(w, "# HELP stingray_up Whether the engine console is connected.")
+	fmt.Fprintln(w, "# TYPE stingray_up gauge")
+	var hosts []string
+	for host := range m.up {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		v := 0
+		if m.up[host] {
+			v = 1
+		}
+		fmt.Fprintf(w, "stingray_up%v %d\n", labels{host: host}, v)
+	}
+
+	fmt.Fprintln(w, "# HELP stingray_messages_total Console messages received.")
+	fmt.Fprintln(w, "# TYPE stingray_messages_total counter")
+	var counters []string
+	for l, v := range m.counters {
+		counters = append(counters, fmt.Sprintf("stingray_messages_total%v %d", l, v))
+	}
+	sort.Strings(counters)
+	for _, line := range counters {
+		fmt.Fprintln(w, line)
+	}
+
+	byName := make(map[string][]string)
+	for s, v := range m.gauges {
+		name := gaugePrefix + s.name
+		byName[name] = append(byName[name], fmt.Sprintf("%s%v %s", name, s.labels, strconv.FormatFloat(v, 'g', -1, 64)))
+	}
+
+	var names []string
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+		lines := byName[name]
+		sort.Strings(lines)
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		counters: make(map[labels]uint64),
+		gauges:   make(map[series]float64),
+		up:       make(map[string]bool),
+	}
+}
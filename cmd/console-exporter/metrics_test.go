@@ -0,0 +1,77 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMetricsFormat(t *testing.T) {
+	m := newMetrics()
+	m.setUp("b:14030", false)
+	m.setUp("a:14030", true)
+	m.count(labels{"a:14030", "Lua", "info"})
+	m.count(labels{"a:14030", "Lua", "info"})
+	m.count(labels{"a:14030", `say "hi"\n`, "error"})
+
+	// Gauges named like the exporter metrics are kept apart.
+	m.set("up", labels{host: "a:14030", system: "Lua"}, 0)
+	m.set("fps", labels{host: "a:14030", system: "Lua"}, 59.5)
+	m.set("fps", labels{host: "b:14030", system: "Lua"}, 1e21)
+
+	expected := `# HELP stingray_up Whether the engine console is connected.
+# TYPE stingray_up gauge
+stingray_up{host="a:14030"} 1
+stingray_up{host="b:14030"} 0
+# HELP stingray_messages_total Console messages received.
+# TYPE stingray_messages_total counter
+stingray_messages_total{host="a:14030",system="Lua",level="info"} 2
+stingray_messages_total{host="a:14030",system="say \"hi\"\\n",level="error"} 1
+# TYPE stingray_engine_fps gauge
+stingray_engine_fps{host="a:14030",system="Lua"} 59.5
+stingray_engine_fps{host="b:14030",system="Lua"} 1e+21
+# TYPE stingray_engine_up gauge
+stingray_engine_up{host="a:14030",system="Lua"} 0
+`
+
+	var buf bytes.Buffer
+	m.writeTo(&buf)
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestGaugeFlags(t *testing.T) {
+	var g gaugeFlags
+	if err := g.Set(`fps=fps: ([0-9.]+)`); err != nil {
+		t.Fatal(err)
+	}
+	if g.String() != "fps=fps: ([0-9.]+)" {
+		t.Errorf("unexpected rules: %s", g.String())
+	}
+
+	for _, s := range []string{"fps", "1fps=([0-9]+)", "fps=[0-9]+", "fps=([0-9]+"} {
+		if err := g.Set(s); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+	if len(g) != 1 {
+		t.Errorf("unexpected rules: %d", len(g))
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/target"
+)
+
+var arguments struct {
+	hostAddress,
+	targetName,
+	listenAddress string
+	timeout time.Duration
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Printf("Usage: console-proxy [options]\n\n")
+		flag.PrintDefaults()
+	}
+
+	flag.StringVar(&arguments.hostAddress, "host", "", "engine address, address:[port] (default localhost, or the host of -target)")
+	flag.StringVar(&arguments.targetName, "target", "", "named target from "+target.DefaultPath())
+	flag.StringVar(&arguments.listenAddress, "listen", ":14040", "address to accept console clients on")
+	flag.DurationVar(&arguments.timeout, "timeout", 0, "disconnect unresponsive engines after this time, 0 to disable")
+}
+
+func errorln(msg ...interface{}) {
+	fmt.Fprintln(os.Stderr, msg...)
+	os.Exit(-1)
+}
+
+func main() {
+	flag.Parse()
+	fmt.Println("Stingray Console Proxy")
+	fmt.Printf("Copyright (C) 2016 Andreas T Jonsson\n\n")
+
+	tgt, err := target.FromFlags(arguments.targetName, arguments.hostAddress)
+	if err != nil {
+		errorln(err)
+	}
+	log.Printf("connecting to %s...\n", tgt.Address())
+	con, err := tgt.Connect()
+	if err != nil {
+		errorln("could not connect to: " + tgt.Address())
+	}
+	defer con.Close()
+	con.SetHeartbeatTimeout(arguments.timeout)
+
+	proxy := console.NewProxy(con)
+	proxy.Logger = log.New(os.Stdout, "", log.LstdFlags)
+
+	go func() {
+		err := proxy.Run()
+		errorln("lost connection to engine:", err)
+	}()
+
+	log.Println("accepting clients on", arguments.listenAddress)
+	if err := http.ListenAndServe(arguments.listenAddress, proxy); err != nil {
+		errorln(err)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/target"
+)
+
+var arguments struct {
+	hostAddress,
+	targetName,
+	listenAddress,
+	inputFile,
+	recordFile string
+	speed float64
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Printf("Usage: console-replay [options]\n\n")
+		flag.PrintDefaults()
+	}
+
+	flag.StringVar(&arguments.hostAddress, "host", "", "engine address when recording, address:[port] (default localhost, or the host of -target)")
+	flag.StringVar(&arguments.targetName, "target", "", "named target from "+target.DefaultPath())
+	flag.StringVar(&arguments.listenAddress, "listen", fmt.Sprintf(":%d", console.DefaultPort), "address to serve the replay on")
+	flag.StringVar(&arguments.inputFile, "input", "", "recording to replay")
+	flag.StringVar(&arguments.recordFile, "record", "", "record engine traffic to file")
+	flag.Float64Var(&arguments.speed, "speed", 1, "playback speed multiplier, 0 for no delay")
+}
+
+func errorln(msg ...interface{}) {
+	fmt.Fprintln(os.Stderr, msg...)
+	os.Exit(-1)
+}
+
+func assertln(err error, msg ...interface{}) {
+	if err != nil {
+		errorln(msg...)
+	}
+}
+
+func record() {
+	fp, err := os.Create(arguments.recordFile)
+	assertln(err, err)
+	defer fp.Close()
+
+	rec, err := console.NewRecorder(fp)
+	assertln(err, err)
+
+	tgt, err := target.FromFlags(arguments.targetName, arguments.hostAddress)
+	if err != nil {
+		errorln(err)
+	}
+	log.Printf("connecting to %s...\n", tgt.Address())
+	con, err := tgt.Connect()
+	assertln(err, "could not connect to: "+tgt.Address())
+	defer con.Close()
+
+	con.Record(rec)
+	log.Println("recording to", arguments.recordFile)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for {
+			if _, _, err := con.Receive(); err != nil {
+				log.Println(err)
+				break
+			}
+		}
+		sig <- os.Interrupt
+	}()
+
+	<-sig
+	assertln(rec.Flush(), "could not write recording")
+	log.Println("recording saved")
+}
+
+func replay() {
+	fp, err := os.Open(arguments.inputFile)
+	assertln(err, "could not open: "+arguments.inputFile)
+
+	rp, err := console.NewReplayer(fp)
+	fp.Close()
+	assertln(err, err)
+
+	rp.Speed = arguments.speed
+	log.Printf("serving %d frames on %s\n", len(rp.Frames()), arguments.listenAddress)
+	err = http.ListenAndServe(arguments.listenAddress, rp)
+	assertln(err, err)
+}
+
+func main() {
+	flag.Parse()
+	fmt.Println("Stingray Console Replay")
+	fmt.Printf("Copyright (C) 2016 Andreas T Jonsson\n\n")
+
+	switch {
+	case arguments.recordFile != "":
+		record()
+	case arguments.inputFile != "":
+		replay()
+	default:
+		flag.Usage()
+		os.Exit(-1)
+	}
+}
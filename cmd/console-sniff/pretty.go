@@ -0,0 +1,80 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+func prettyPrint(w io.Writer, v sjson.Value, indent int) {
+	pad := strings.Repeat("    ", indent)
+
+	switch v := v.(type) {
+	case map[string]sjson.Value:
+		if len(v) == 0 {
+			fmt.Fprint(w, "{}")
+			return
+		}
+
+		var keys []string
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintln(w, "{")
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s    %s = ", pad, k)
+			prettyPrint(w, v[k], indent+1)
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s}", pad)
+	case []sjson.Value:
+		if len(v) == 0 {
+			fmt.Fprint(w, "[]")
+			return
+		}
+
+		fmt.Fprintln(w, "[")
+		for _, e := range v {
+			fmt.Fprintf(w, "%s    ", pad)
+			prettyPrint(w, e, indent+1)
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s]", pad)
+	case string:
+		fmt.Fprint(w, strconv.Quote(v))
+	case nil:
+		fmt.Fprint(w, "null")
+	default:
+		fmt.Fprint(w, v)
+	}
+}
+
+func prettyString(v sjson.Value) string {
+	var buf bytes.Buffer
+	prettyPrint(&buf, v, 0)
+	return buf.String()
+}
@@ -0,0 +1,189 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/target"
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+var arguments struct {
+	hostAddress,
+	targetName,
+	listenAddress,
+	types string
+	hexBytes int
+}
+
+var (
+	typeFilter map[string]bool
+	outputLock sync.Mutex
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Printf("Usage: console-sniff [options]\n\n")
+		flag.PrintDefaults()
+	}
+
+	flag.StringVar(&arguments.hostAddress, "host", "", "engine address, address:[port] (default localhost, or the host of -target)")
+	flag.StringVar(&arguments.targetName, "target", "", "named target from "+target.DefaultPath())
+	flag.StringVar(&arguments.listenAddress, "listen", "", "sit between tools and engine, accepting tools on this address")
+	flag.StringVar(&arguments.types, "type", "", "only show these message types, comma separated")
+	flag.IntVar(&arguments.hexBytes, "hex", 64, "bytes of binary payload to dump")
+}
+
+func errorln(msg ...interface{}) {
+	fmt.Fprintln(os.Stderr, msg...)
+	os.Exit(-1)
+}
+
+func messageType(val sjson.Value) string {
+	if m, ok := val.(map[string]sjson.Value); ok {
+		ty, _ := m["type"].(string)
+		return ty
+	}
+	return ""
+}
+
+func printFrame(f console.TapFrame) {
+	var (
+		buf    bytes.Buffer
+		header sjson.Value
+		ty     string
+	)
+
+	if f.Binary {
+		if h, payload, err := console.DecodeBinary(f.Data); err == nil {
+			header = h
+			ty = messageType(h)
+			data, _ := ioutil.ReadAll(payload)
+			fmt.Fprintf(&buf, "%s\n", prettyString(h))
+			dumpPayload(&buf, data)
+		} else {
+			dumpPayload(&buf, f.Data)
+		}
+	} else {
+		val, err := sjson.Decode(sjson.NewLexer(bytes.NewReader(f.Data)))
+		if err != nil {
+			fmt.Fprintf(&buf, "invalid SJSON (%v): %q\n", err, f.Data)
+		} else {
+			ty = messageType(val)
+			fmt.Fprintf(&buf, "%s\n", prettyString(val))
+		}
+	}
+
+	if typeFilter != nil && !typeFilter[ty] {
+		return
+	}
+
+	kind := "text"
+	if f.Binary {
+		kind = "binary"
+		if header == nil {
+			kind = "binary (raw)"
+		}
+	}
+
+	client := ""
+	if f.Client != "" {
+		client = " " + f.Client
+	}
+
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	fmt.Printf("%s %s%s %s %d bytes\n%s\n", f.Time.Format("15:04:05.000"), f.Direction, client, kind, len(f.Data), buf.String())
+}
+
+func dumpPayload(buf *bytes.Buffer, data []byte) {
+	fmt.Fprintf(buf, "payload: %d bytes\n", len(data))
+	n := len(data)
+	if n > arguments.hexBytes {
+		n = arguments.hexBytes
+	}
+	if n > 0 {
+		buf.WriteString(hex.Dump(data[:n]))
+	}
+}
+
+func sniff(con *console.Console) {
+	for {
+		data, binary, err := con.ReceiveRaw()
+		if err != nil {
+			errorln(err)
+		}
+		printFrame(console.TapFrame{Direction: console.FromEngine, Time: time.Now(), Binary: binary, Data: data})
+	}
+}
+
+func intercept(con *console.Console) {
+	proxy := console.NewProxy(con)
+	proxy.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	proxy.Tap = printFrame
+
+	go func() {
+		err := proxy.Run()
+		errorln("lost connection to engine:", err)
+	}()
+
+	log.Println("accepting tools on", arguments.listenAddress)
+	if err := http.ListenAndServe(arguments.listenAddress, proxy); err != nil {
+		errorln(err)
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if arguments.types != "" {
+		typeFilter = make(map[string]bool)
+		for _, ty := range strings.Split(arguments.types, ",") {
+			typeFilter[strings.TrimSpace(ty)] = true
+		}
+	}
+
+	tgt, err := target.FromFlags(arguments.targetName, arguments.hostAddress)
+	if err != nil {
+		errorln(err)
+	}
+	log.Printf("connecting to %s...\n", tgt.Address())
+	con, err := tgt.Connect()
+	if err != nil {
+		errorln("could not connect to: " + tgt.Address())
+	}
+	defer con.Close()
+
+	if arguments.listenAddress != "" {
+		intercept(con)
+	} else {
+		sniff(con)
+	}
+}
@@ -25,16 +25,36 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/target"
+	"github.com/andreas-jonsson/go-stingray/sjson"
 	"github.com/jroimartin/gocui"
 )
 
+type commandSender interface {
+	SendCommand(ty console.CommandType, command string) error
+	SendCommandArgs(name string, args ...sjson.Value) error
+}
+
 var arguments struct {
 	hostAddress,
-	inputFile string
-	quiet bool
+	hostList,
+	targetName,
+	inputFile,
+	minLevel,
+	systems,
+	excludeSystems,
+	match string
+	quiet,
+	timestamps,
+	ack bool
+	timeout time.Duration
+	rate    float64
+	batch   int
 }
 
 func errorln(msg ...interface{}) {
@@ -42,7 +62,7 @@ func errorln(msg ...interface{}) {
 		fmt.Fprintln(os.Stderr, msg...)
 		os.Exit(-1)
 	} else {
-		goCUI.Execute(func(g *gocui.Gui) error {
+		goCUI.Update(func(g *gocui.Gui) error {
 			g.Close()
 			fmt.Fprintln(os.Stderr, msg...)
 			os.Exit(-1)
@@ -90,33 +110,156 @@ func showLicense() {
 	println(string(license))
 }
 
+func quietGroup() {
+	tgt, err := target.FromFlags(arguments.targetName, arguments.hostAddress)
+	assertErrln(err)
+	group, err := console.NewGroup(splitList(arguments.hostList), "")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(group.Consoles()) == 0 {
+		errorln("could not connect to any host")
+	}
+	defer group.Close()
+
+	for _, con := range group.Consoles() {
+		con.SetHeartbeatTimeout(arguments.timeout)
+	}
+
+	if arguments.inputFile != "" {
+		go processInput(group)
+	}
+
+	active := len(group.Consoles())
+	for msg := range group.ReceiveMessages(messageFilter(tgt)) {
+		if msg.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", msg.Host, msg.Err)
+			if active--; active == 0 {
+				errorln("lost connection to all hosts")
+			}
+			continue
+		}
+		fmt.Printf("%s %s\n", msg.Host, formatMessage(msg.Message))
+	}
+}
+
 func quiet() {
-	host := arguments.hostAddress
-	con, err := console.NewConsole(host, "")
-	assertln(err, errors.New("could not connect to: "+host))
+	if arguments.hostList != "" {
+		quietGroup()
+		return
+	}
+
+	tgt, err := target.FromFlags(arguments.targetName, arguments.hostAddress)
+	assertErrln(err)
+	con, err := tgt.Connect()
+	assertln(err, errors.New("could not connect to: "+tgt.Address()))
 	defer con.Close()
+	con.SetHeartbeatTimeout(arguments.timeout)
 
+	var queue *console.SendQueue
 	if arguments.inputFile != "" {
-		go processInput(con)
+		queue = console.NewSendQueue(con, console.QueueConfig{
+			Rate:       arguments.rate,
+			BatchSize:  arguments.batch,
+			WaitForAck: arguments.ack,
+		})
+		defer queue.Close()
+
+		go func() {
+			processInput(queue)
+			reportQueue(queue)
+		}()
 	}
 
+	filter := messageFilter(tgt)
 	for {
 		msg, err := con.ReceiveMessage()
 		assertErrln(err)
-		fmt.Println(msg)
+		if queue != nil && queue.Observe(msg) {
+			continue
+		}
+		if filter.Match(msg) {
+			fmt.Println(formatMessage(msg))
+		}
 	}
 }
 
-func executeCommand(con *console.Console, cmd string) error {
-	ty := console.Command
+func reportQueue(queue *console.SendQueue) {
+	err := queue.Flush()
+	stats := queue.Stats()
+
+	fmt.Fprintf(os.Stderr, "sent %d commands", stats.Sent)
+	if arguments.ack {
+		fmt.Fprintf(os.Stderr, ", %d acknowledged", stats.Acked)
+	}
+	if stats.Stalls > 0 {
+		fmt.Fprintf(os.Stderr, ", input blocked %d times for %v", stats.Stalls, stats.Blocked)
+	}
+	fmt.Fprintln(os.Stderr)
+	assertErrln(err)
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func messageFilter(tgt *target.Target) console.Filter {
+	var filters []console.Filter
+
+	defaults, err := tgt.Filter()
+	assertErrln(err)
+	if defaults != nil {
+		filters = append(filters, defaults)
+	}
+
+	if arguments.minLevel != "" {
+		level, _ := console.ParseLevel(arguments.minLevel)
+		filters = append(filters, console.MinLevel(level))
+	}
+	if systems := splitList(arguments.systems); len(systems) > 0 {
+		filters = append(filters, console.IncludeSystems(systems...))
+	}
+	if systems := splitList(arguments.excludeSystems); len(systems) > 0 {
+		filters = append(filters, console.ExcludeSystems(systems...))
+	}
+	if arguments.match != "" {
+		re, err := regexp.Compile(arguments.match)
+		assertln(err, errors.New("invalid expression: "+arguments.match))
+		filters = append(filters, console.MatchText(re))
+	}
+
+	if len(filters) == 0 {
+		return nil
+	}
+	return console.And(filters...)
+}
+
+func formatMessage(msg console.Message) string {
+	if arguments.timestamps {
+		return msg.Time.Format("15:04:05.000 ") + msg.String()
+	}
+	return msg.String()
+}
+
+func executeCommand(con commandSender, cmd string) error {
 	if cmd[0] == '#' {
-		ty = console.Script
-		cmd = cmd[1:]
+		return con.SendCommand(console.Script, cmd[1:])
 	}
-	return con.SendCommand(ty, cmd)
+
+	name, args, err := console.ParseCommand(cmd)
+	if err != nil {
+		return err
+	}
+	return con.SendCommandArgs(name, args...)
 }
 
-func processInput(con *console.Console) {
+func processInput(con commandSender) {
 	var err error
 	fp := os.Stdin
 
@@ -129,7 +272,12 @@ func processInput(con *console.Console) {
 	scanner := bufio.NewScanner(fp)
 	for scanner.Scan() {
 		if line := scanner.Text(); len(line) > 0 {
-			assertErrln(executeCommand(con, line))
+			err := executeCommand(con, line)
+			if groupErr, ok := err.(console.GroupError); ok {
+				fmt.Fprintln(os.Stderr, groupErr)
+			} else {
+				assertErrln(err)
+			}
 		}
 	}
 }
@@ -140,13 +288,43 @@ func init() {
 		flag.PrintDefaults()
 	}
 
-	flag.StringVar(&arguments.hostAddress, "host", "localhost", "host address, address:[port]")
+	flag.StringVar(&arguments.hostAddress, "host", "", "host address, address:[port] (default localhost, or the host of -target)")
+	flag.StringVar(&arguments.targetName, "target", "", "named target from "+target.DefaultPath())
 	flag.StringVar(&arguments.inputFile, "input", "", "input file, '-' for stdin")
 	flag.BoolVar(&arguments.quiet, "q", false, "no GUI, pipe-only")
+	flag.StringVar(&arguments.hostList, "hosts", "", "comma separated host addresses, requires -q")
+	flag.DurationVar(&arguments.timeout, "timeout", 0, "disconnect unresponsive engines after this time, 0 to disable")
+	flag.Float64Var(&arguments.rate, "rate", 0, "maximum input commands per second, 0 for unlimited, not with -hosts")
+	flag.IntVar(&arguments.batch, "batch", 1, "input commands sent per acknowledgement, not with -hosts")
+	flag.BoolVar(&arguments.ack, "ack", false, "wait for the engine to acknowledge each input batch, not with -hosts")
+	flag.BoolVar(&arguments.timestamps, "time", false, "prefix messages with receive time")
+	flag.StringVar(&arguments.minLevel, "level", "", "minimum message level, (info, warning, error)")
+	flag.StringVar(&arguments.systems, "system", "", "only show these systems, comma separated")
+	flag.StringVar(&arguments.excludeSystems, "exclude", "", "hide these systems, comma separated")
+	flag.StringVar(&arguments.match, "match", "", "only show messages matching regular expression")
 }
 
 func main() {
 	flag.Parse()
+	if arguments.hostList != "" && !arguments.quiet {
+		fmt.Fprintln(os.Stderr, "-hosts requires -q")
+		os.Exit(-1)
+	}
+	if arguments.hostList != "" {
+		// Input is broadcast to the group without a send queue.
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "rate", "batch", "ack":
+				fmt.Fprintf(os.Stderr, "-%s can not be used with -hosts\n", f.Name)
+				os.Exit(-1)
+			}
+		})
+	}
+	if _, err := console.ParseLevel(arguments.minLevel); arguments.minLevel != "" && err != nil {
+		fmt.Fprintln(os.Stderr, "invalid level: "+arguments.minLevel)
+		os.Exit(-1)
+	}
+
 	if arguments.quiet {
 		quiet()
 	} else {
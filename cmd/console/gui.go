@@ -24,6 +24,7 @@ import (
 	"strings"
 
 	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/target"
 	"github.com/jroimartin/gocui"
 )
 
@@ -31,7 +32,7 @@ var goCUI *gocui.Gui
 
 func doPrint(f string, msg []interface{}) {
 	if !arguments.quiet {
-		goCUI.Execute(func(g *gocui.Gui) error {
+		goCUI.Update(func(g *gocui.Gui) error {
 			v, err := g.View("top")
 			if err != nil {
 				return err
@@ -48,7 +49,7 @@ func doPrint(f string, msg []interface{}) {
 }
 
 func setTitle(f string, a ...interface{}) {
-	goCUI.Execute(func(g *gocui.Gui) error {
+	goCUI.Update(func(g *gocui.Gui) error {
 		v, _ := g.View("top")
 		v.Title = fmt.Sprintf(f, a...)
 		return nil
@@ -79,7 +80,7 @@ func layout(g *gocui.Gui) error {
 			return err
 		}
 
-		if err := g.SetCurrentView("bottom"); err != nil {
+		if _, err := g.SetCurrentView("bottom"); err != nil {
 			return err
 		}
 
@@ -90,7 +91,7 @@ func layout(g *gocui.Gui) error {
 }
 
 func setupInputKeybindings(con *console.Console) {
-	goCUI.Execute(func(g *gocui.Gui) error {
+	goCUI.Update(func(g *gocui.Gui) error {
 		enter := func(g *gocui.Gui, v *gocui.View) error {
 			str := strings.TrimSpace(v.Buffer())
 
@@ -100,12 +101,14 @@ func setupInputKeybindings(con *console.Console) {
 			default:
 				if len(str) > 0 {
 					printf("> %s\n", str)
-					assertErrln(executeCommand(con, str))
+					if err := executeCommand(con, str); err != nil {
+						printf("error: %v\n", err)
+					}
 				}
 			}
 
 			v.Clear()
-			return nil
+			return v.SetCursor(0, 0)
 		}
 
 		v, err := g.View("bottom")
@@ -125,8 +128,9 @@ func setupKeybindings() {
 }
 
 func gui() {
-	goCUI = gocui.NewGui()
-	if err := goCUI.Init(); err != nil {
+	var err error
+	goCUI, err = gocui.NewGui(gocui.OutputNormal)
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(-1)
 	}
@@ -135,26 +139,29 @@ func gui() {
 	goCUI.FgColor = gocui.ColorCyan
 	goCUI.BgColor = gocui.ColorBlue
 	goCUI.Cursor = true
-	goCUI.SetLayout(layout)
+	goCUI.SetManagerFunc(layout)
 	setupKeybindings()
 
 	go func() {
-		host := arguments.hostAddress
+		tgt, err := target.FromFlags(arguments.targetName, arguments.hostAddress)
+		assertErrln(err)
+		host := tgt.Address()
 		printf("connecting to %s...\n", host)
 
-		con, err := console.NewConsole(host, "")
+		con, err := tgt.Connect()
 		assertln(err, errors.New("could not connect to host"))
 		defer con.Close()
+		con.SetHeartbeatTimeout(arguments.timeout)
 
 		println("connected")
 		setTitle(host)
 		setupInputKeybindings(con)
 
+		filter := messageFilter(tgt)
 		for {
-			msg, err := con.ReceiveMessage()
+			msg, err := con.ReceiveFilteredMessage(filter)
 			assertErrln(err)
-			println(msg)
-
+			println(formatMessage(msg))
 		}
 	}()
 
@@ -0,0 +1,229 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/target"
+)
+
+var arguments struct {
+	hostAddress,
+	targetName,
+	inputPath,
+	outputPath,
+	baselinePath,
+	metrics,
+	command string
+	frames    int
+	duration  time.Duration
+	tolerance float64
+	slack     time.Duration
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Printf("Usage: perfgate [options]\n\n")
+		flag.PrintDefaults()
+	}
+
+	flag.StringVar(&arguments.hostAddress, "host", "", "host address, address:[port] (default localhost, or the host of -target)")
+	flag.StringVar(&arguments.targetName, "target", "", "named target from "+target.DefaultPath())
+	flag.StringVar(&arguments.inputPath, "i", "", "read frames from a capture file instead of the engine")
+	flag.StringVar(&arguments.outputPath, "o", "", "write report to file, SJSON if the extension is .sjson")
+	flag.StringVar(&arguments.baselinePath, "baseline", "", "compare against a previous report")
+	flag.StringVar(&arguments.metrics, "metrics", "avg,p95", "metrics to compare, comma separated ("+strings.Join(console.StatsMetrics, ", ")+")")
+	flag.StringVar(&arguments.command, "command", "", "console command sent before sampling, e.g. to enable the profiler")
+	flag.IntVar(&arguments.frames, "frames", 0, "stop after this many frames, 0 for no limit")
+	flag.DurationVar(&arguments.duration, "duration", 10*time.Second, "sample the engine for this long")
+	flag.Float64Var(&arguments.tolerance, "tolerance", 0.1, "allowed relative increase over the baseline")
+	flag.DurationVar(&arguments.slack, "slack", 100*time.Microsecond, "allowed absolute increase over the baseline")
+}
+
+func errorln(msg ...interface{}) {
+	fmt.Fprintln(os.Stderr, msg...)
+	os.Exit(-1)
+}
+
+func assertln(err error, msg ...interface{}) {
+	if err != nil {
+		errorln(msg...)
+	}
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+func sampleCapture(collector *console.StatsCollector) {
+	fp, err := os.Open(arguments.inputPath)
+	assertln(err, err)
+	defer fp.Close()
+
+	reader, err := console.NewCaptureReader(fp)
+	assertln(err, "could not read capture: "+arguments.inputPath)
+
+	for arguments.frames == 0 || collector.Frames() < arguments.frames {
+		frame, err := reader.NextFrame()
+		if err == io.EOF {
+			return
+		}
+		assertln(err, err)
+		collector.AddFrame(frame)
+	}
+}
+
+func sampleEngine(tgt *target.Target, collector *console.StatsCollector) {
+	fmt.Printf("connecting to %s...\n", tgt.Address())
+	con, err := tgt.Connect()
+	assertln(err, "could not connect to: "+tgt.Address())
+	defer con.Close()
+
+	if arguments.command != "" {
+		err := con.SendCommand(console.Command, arguments.command)
+		assertln(err, err)
+	}
+
+	fmt.Printf("sampling for %v...\n", arguments.duration)
+	con.SetDeadline(time.Now().Add(arguments.duration))
+	session := console.NewProfilerSession(con)
+
+	for arguments.frames == 0 || collector.Frames() < arguments.frames {
+		frame, err := session.NextFrame()
+		if isTimeout(err) && collector.Frames() > 0 {
+			return
+		}
+		assertln(err, err)
+		collector.AddFrame(frame)
+	}
+}
+
+func printStats(stats []console.ScopeStats) {
+	fmt.Printf("%-40s %8s %10s %10s %10s %10s\n", "scope", "frames", "avg ms", "p95 ms", "p99 ms", "max ms")
+	for _, s := range stats {
+		fmt.Printf("%-40s %8d %10.3f %10.3f %10.3f %10.3f\n", s.Scope, s.Frames, s.Avg*1000, s.P95*1000, s.P99*1000, s.Max*1000)
+	}
+}
+
+// parseMetrics splits a comma separated list of metrics, rejecting names
+// not in console.StatsMetrics so that a typo cannot pass the gate.
+func parseMetrics(s string) ([]string, error) {
+	var metrics []string
+	for _, m := range strings.Split(s, ",") {
+		if m = strings.TrimSpace(m); m == "" {
+			continue
+		}
+
+		known := false
+		for _, name := range console.StatsMetrics {
+			known = known || m == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown metric: %s", m)
+		}
+		metrics = append(metrics, m)
+	}
+
+	if len(metrics) == 0 {
+		return nil, errors.New("no metrics to compare")
+	}
+	return metrics, nil
+}
+
+// compare returns true if any scope in the baseline regressed.
+func compare(stats []console.ScopeStats, metrics []string) bool {
+	baseline, err := readReport(arguments.baselinePath)
+	assertln(err, "could not read baseline: ", err)
+
+	base := make([]console.ScopeStats, len(baseline.Scopes))
+	tolerances := make(map[string]float64)
+	for i, scope := range baseline.Scopes {
+		base[i] = scope.stats()
+		if scope.Tolerance != nil {
+			tolerances[scope.Scope] = *scope.Tolerance
+		}
+	}
+
+	regressions, missing := console.CompareStatsFunc(base, stats, metrics, func(scope string) console.Tolerance {
+		tol := console.Tolerance{Relative: arguments.tolerance, Absolute: arguments.slack.Seconds()}
+		if rel, ok := tolerances[scope]; ok {
+			tol.Relative = rel
+		}
+		return tol
+	})
+
+	for _, scope := range missing {
+		fmt.Printf("warning: %s not found\n", scope)
+	}
+	for _, r := range regressions {
+		fmt.Printf("REGRESSION %s %s: %.3f ms, baseline %.3f ms, limit %.3f ms\n", r.Scope, r.Metric, r.Current*1000, r.Baseline*1000, r.Limit*1000)
+	}
+	return len(regressions) > 0
+}
+
+func main() {
+	flag.Parse()
+
+	metrics, err := parseMetrics(arguments.metrics)
+	assertln(err, err)
+
+	collector := console.NewStatsCollector()
+	host := arguments.inputPath
+
+	if arguments.inputPath != "" {
+		sampleCapture(collector)
+	} else {
+		tgt, err := target.FromFlags(arguments.targetName, arguments.hostAddress)
+		if err != nil {
+			errorln(err)
+		}
+		host = tgt.Address()
+		sampleEngine(tgt, collector)
+	}
+
+	if collector.Frames() == 0 {
+		errorln("no frames received")
+	}
+	fmt.Printf("%d frames\n", collector.Frames())
+
+	stats := collector.Stats()
+	printStats(stats)
+
+	if arguments.outputPath != "" {
+		err := newReport(host, collector.Frames(), stats).write(arguments.outputPath)
+		assertln(err, err)
+		fmt.Println("report written to: " + arguments.outputPath)
+	}
+
+	if arguments.baselinePath != "" {
+		if compare(stats, metrics) {
+			os.Exit(1)
+		}
+		fmt.Println("no regressions")
+	}
+}
@@ -0,0 +1,36 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMetrics(t *testing.T) {
+	metrics, err := parseMetrics(" avg, p95,,max ")
+	if err != nil || !reflect.DeepEqual(metrics, []string{"avg", "p95", "max"}) {
+		t.Errorf("unexpected metrics: %v, %v", metrics, err)
+	}
+
+	for _, s := range []string{"avg,p90", "AVG", "", " , "} {
+		if _, err := parseMetrics(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+// Reports store times in milliseconds. A baseline scope may set its own
+// relative tolerance, overriding the -tolerance flag.
+type reportScope struct {
+	Scope     string   `json:"scope"`
+	Frames    int      `json:"frames"`
+	Calls     int      `json:"calls"`
+	Min       float64  `json:"min_ms"`
+	Avg       float64  `json:"avg_ms"`
+	Max       float64  `json:"max_ms"`
+	P50       float64  `json:"p50_ms"`
+	P95       float64  `json:"p95_ms"`
+	P99       float64  `json:"p99_ms"`
+	Tolerance *float64 `json:"tolerance,omitempty"`
+}
+
+type report struct {
+	Host   string        `json:"host"`
+	Frames int           `json:"frames"`
+	Scopes []reportScope `json:"scopes"`
+}
+
+func newReport(host string, frames int, stats []console.ScopeStats) *report {
+	r := &report{Host: host, Frames: frames, Scopes: make([]reportScope, len(stats))}
+	for i, s := range stats {
+		r.Scopes[i] = reportScope{
+			Scope:  s.Scope,
+			Frames: s.Frames,
+			Calls:  s.Calls,
+			Min:    s.Min * 1000,
+			Avg:    s.Avg * 1000,
+			Max:    s.Max * 1000,
+			P50:    s.P50 * 1000,
+			P95:    s.P95 * 1000,
+			P99:    s.P99 * 1000,
+		}
+	}
+	return r
+}
+
+func (s *reportScope) stats() console.ScopeStats {
+	return console.ScopeStats{
+		Scope:  s.Scope,
+		Frames: s.Frames,
+		Calls:  s.Calls,
+		Min:    s.Min / 1000,
+		Avg:    s.Avg / 1000,
+		Max:    s.Max / 1000,
+		P50:    s.P50 / 1000,
+		P95:    s.P95 / 1000,
+		P99:    s.P99 / 1000,
+	}
+}
+
+func isSJSON(path string) bool {
+	return strings.HasSuffix(path, ".sjson")
+}
+
+// sjsonValue converts the report through its JSON representation, so both
+// formats use the same field names.
+func (r *report) sjsonValue() (sjson.Value, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return toSJSON(v), nil
+}
+
+func toSJSON(v interface{}) sjson.Value {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]sjson.Value, len(v))
+		for k, val := range v {
+			m[k] = toSJSON(val)
+		}
+		return m
+	case []interface{}:
+		s := make([]sjson.Value, len(v))
+		for i, val := range v {
+			s[i] = toSJSON(val)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+func fromSJSON(v sjson.Value) interface{} {
+	switch v := v.(type) {
+	case map[string]sjson.Value:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[k] = fromSJSON(val)
+		}
+		return m
+	case []sjson.Value:
+		s := make([]interface{}, len(v))
+		for i, val := range v {
+			s[i] = fromSJSON(val)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+func (r *report) write(path string) error {
+	fp, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	if isSJSON(path) {
+		v, err := r.sjsonValue()
+		if err != nil {
+			return err
+		}
+		return sjson.Encode(fp, v)
+	}
+
+	enc := json.NewEncoder(fp)
+	enc.SetIndent("", "\t")
+	return enc.Encode(r)
+}
+
+func readReport(path string) (*report, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	var r report
+	if !isSJSON(path) {
+		err := json.NewDecoder(fp).Decode(&r)
+		return &r, err
+	}
+
+	v, err := sjson.Decode(sjson.NewLexer(fp))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if _, ok := v.(map[string]sjson.Value); !ok {
+		return nil, errors.New("invalid report: " + path)
+	}
+
+	data, err := json.Marshal(fromSJSON(v))
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &r)
+	return &r, err
+}
@@ -0,0 +1,199 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/flamegraph"
+)
+
+const pathWidth = 48
+
+var arguments struct {
+	outputPath,
+	sortBy string
+	frames,
+	limit int
+	threshold time.Duration
+	icicle    bool
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Printf("Usage: profile-diff [options] base.srcap current.srcap\n\n")
+		flag.PrintDefaults()
+	}
+
+	flag.StringVar(&arguments.outputPath, "o", "", "write a differential flame graph SVG to file")
+	flag.StringVar(&arguments.sortBy, "sort", "inclusive", "sort by absolute change in (inclusive, exclusive, calls)")
+	flag.IntVar(&arguments.frames, "frames", 0, "read at most this many frames from each capture, 0 for all")
+	flag.IntVar(&arguments.limit, "limit", 30, "number of scopes to report, 0 for all")
+	flag.DurationVar(&arguments.threshold, "threshold", 10*time.Microsecond, "hide scopes with smaller changes in time per frame and unchanged calls")
+	flag.BoolVar(&arguments.icicle, "icicle", false, "draw the flame graph as an icicle graph")
+}
+
+func errorln(msg ...interface{}) {
+	fmt.Fprintln(os.Stderr, msg...)
+	os.Exit(-1)
+}
+
+func assertln(err error, msg ...interface{}) {
+	if err != nil {
+		errorln(msg...)
+	}
+}
+
+func readCapture(path string) *console.PathCollector {
+	fp, err := os.Open(path)
+	assertln(err, err)
+	defer fp.Close()
+
+	reader, err := console.NewCaptureReader(fp)
+	assertln(err, "could not read capture: "+path)
+
+	collector := console.NewPathCollector()
+
+	for arguments.frames == 0 || collector.Frames() < arguments.frames {
+		frame, err := reader.NextFrame()
+		if err == io.EOF {
+			break
+		}
+		assertln(err, err)
+
+		collector.AddFrame(frame)
+	}
+
+	if collector.Frames() == 0 {
+		errorln("no frames in capture: " + path)
+	}
+	return collector
+}
+
+func sortDeltas(deltas []console.ScopeDelta) {
+	var key func(d *console.ScopeDelta) float64
+	switch arguments.sortBy {
+	case "inclusive":
+		// DiffPaths already sorts by inclusive time.
+		return
+	case "exclusive":
+		key = func(d *console.ScopeDelta) float64 { return d.Delta.Exclusive }
+	case "calls":
+		key = func(d *console.ScopeDelta) float64 { return d.Delta.Calls }
+	default:
+		errorln("invalid sort order: " + arguments.sortBy)
+	}
+
+	sort.SliceStable(deltas, func(i, j int) bool {
+		return math.Abs(key(&deltas[i])) > math.Abs(key(&deltas[j]))
+	})
+}
+
+func significant(d *console.ScopeDelta) bool {
+	t := arguments.threshold.Seconds()
+	return math.Abs(d.Delta.Inclusive) >= t || math.Abs(d.Delta.Exclusive) >= t || d.Delta.Calls != 0
+}
+
+func formatPath(path []string) string {
+	s := []rune(strings.Join(path, "/"))
+	if len(s) > pathWidth {
+		s = append([]rune(".."), s[len(s)-pathWidth+2:]...)
+	}
+	return string(s)
+}
+
+func formatRelative(d *console.ScopeDelta, rel float64) string {
+	switch {
+	case d.Added():
+		return "new"
+	case d.Removed():
+		return "removed"
+	case math.IsInf(rel, 0):
+		return "-"
+	}
+	return fmt.Sprintf("%+.1f%%", rel*100)
+}
+
+func printDeltas(deltas []console.ScopeDelta) {
+	fmt.Printf("%-*s %10s %10s %8s %10s %10s %8s %8s %8s\n", pathWidth, "scope",
+		"incl ms", "delta", "rel", "excl ms", "delta", "rel", "calls", "delta")
+
+	var n int
+	for i := range deltas {
+		d := &deltas[i]
+		if !significant(d) {
+			continue
+		}
+		if n++; arguments.limit > 0 && n > arguments.limit {
+			fmt.Println("...")
+			return
+		}
+
+		fmt.Printf("%-*s %10.3f %+10.3f %8s %10.3f %+10.3f %8s %8.2f %+8.2f\n", pathWidth, formatPath(d.Path),
+			d.Current.Inclusive*1000, d.Delta.Inclusive*1000, formatRelative(d, d.Relative.Inclusive),
+			d.Current.Exclusive*1000, d.Delta.Exclusive*1000, formatRelative(d, d.Relative.Exclusive),
+			d.Current.Calls, d.Delta.Calls)
+	}
+
+	if n == 0 {
+		fmt.Println("no significant changes")
+	}
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(-1)
+	}
+
+	basePath, currentPath := flag.Arg(0), flag.Arg(1)
+	base := readCapture(basePath)
+	current := readCapture(currentPath)
+
+	fmt.Printf("base:    %s, %d frames\n", basePath, base.Frames())
+	fmt.Printf("current: %s, %d frames\n", currentPath, current.Frames())
+	fmt.Println("times and calls are per frame")
+	fmt.Println()
+
+	deltas := console.DiffPaths(base, current)
+	sortDeltas(deltas)
+	printDeltas(deltas)
+
+	if arguments.outputPath != "" {
+		fp, err := os.Create(arguments.outputPath)
+		assertln(err, err)
+		defer fp.Close()
+
+		options := flamegraph.Options{
+			Title:  basePath + " vs " + currentPath,
+			Icicle: arguments.icicle,
+		}
+		err = flamegraph.FromDeltas(deltas).WriteSVG(fp, options)
+		assertln(err, err)
+		fmt.Println("flame graph written to: " + arguments.outputPath)
+	}
+}
@@ -0,0 +1,305 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+)
+
+const (
+	sortAvg = iota
+	sortCurrent
+	sortMax
+	sortName
+	numSortModes
+
+	frameHistory = 512
+
+	// Keys of flat scopes start with flatPrefix, tree keys are the path
+	// joined with pathSeparator.
+	flatPrefix    = "\x01"
+	pathSeparator = "\x00"
+)
+
+var sortNames = [numSortModes]string{"avg", "current", "max", "name"}
+
+// history is a ring of the per frame times of one scope.
+type history struct {
+	frames []int
+	values []float64
+	next   int
+	calls  int
+}
+
+func (h *history) add(frame int, value float64, calls int, window int) {
+	if len(h.values) < window {
+		h.frames = append(h.frames, frame)
+		h.values = append(h.values, value)
+	} else {
+		h.frames[h.next] = frame
+		h.values[h.next] = value
+		h.next = (h.next + 1) % window
+	}
+	h.calls = calls
+}
+
+// stats returns the time in the latest frame and the average and maximum time
+// in the frames of the window where the scope was present.
+func (h *history) stats(latest, window int) (cur, avg, max float64, calls int) {
+	var n int
+	for i, f := range h.frames {
+		if f <= latest-window {
+			continue
+		}
+		v := h.values[i]
+		if f == latest {
+			cur, calls = v, h.calls
+		}
+		if v > max {
+			max = v
+		}
+		avg += v
+		n++
+	}
+	if n > 0 {
+		avg /= float64(n)
+	}
+	return
+}
+
+type row struct {
+	name          string
+	cur, avg, max float64
+	calls         int
+	children      bool
+}
+
+type model struct {
+	lock sync.Mutex
+
+	window     int
+	frames     int
+	frameTimes []float64
+	scopes     map[string]*history
+	children   map[string]map[string]struct{}
+	threads    map[uint32]string
+
+	// thread is the thread shown, if filtered is set.
+	thread   uint32
+	filtered bool
+
+	path     []string
+	flat     bool
+	sortBy   int
+	paused   bool
+	selected int
+}
+
+func newModel(window int) *model {
+	m := &model{window: window, threads: make(map[uint32]string)}
+	m.reset()
+	return m
+}
+
+func (m *model) reset() {
+	m.scopes = make(map[string]*history)
+	m.children = make(map[string]map[string]struct{})
+}
+
+func (m *model) addFrame(frame *console.ProfilerFrame) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.paused {
+		return
+	}
+
+	m.frames++
+	m.frameTimes = append(m.frameTimes, frame.Duration())
+	if len(m.frameTimes) > frameHistory {
+		m.frameTimes = m.frameTimes[len(m.frameTimes)-frameHistory:]
+	}
+
+	type sample struct {
+		time  float64
+		calls int
+	}
+	samples := make(map[string]*sample)
+	active := make(map[string]int)
+
+	add := func(key string, t float64) {
+		s, ok := samples[key]
+		if !ok {
+			s = &sample{}
+			samples[key] = s
+		}
+		s.time += t
+		s.calls++
+	}
+
+	var visit func(s *console.Scope, parent string)
+	visit = func(s *console.Scope, parent string) {
+		name := s.Scope
+		key := parent + pathSeparator + name
+
+		children, ok := m.children[parent]
+		if !ok {
+			children = make(map[string]struct{})
+			m.children[parent] = children
+		}
+		children[name] = struct{}{}
+
+		add(key, s.Inclusive)
+		if active[name] == 0 {
+			add(flatPrefix+name, s.Inclusive)
+		} else {
+			samples[flatPrefix+name].calls++
+		}
+
+		active[name]++
+		for _, c := range s.Children {
+			visit(c, key)
+		}
+		active[name]--
+	}
+
+	for _, t := range frame.Threads {
+		m.threads[t.ThreadID] = t.Thread
+		if m.filtered && t.ThreadID != m.thread {
+			continue
+		}
+		for _, root := range t.Roots {
+			visit(root, "")
+		}
+	}
+
+	for key, s := range samples {
+		h, ok := m.scopes[key]
+		if !ok {
+			h = &history{}
+			m.scopes[key] = h
+		}
+		h.add(m.frames, s.time, s.calls, m.window)
+	}
+}
+
+func (m *model) pathKey() string {
+	if len(m.path) == 0 {
+		return ""
+	}
+	return pathSeparator + strings.Join(m.path, pathSeparator)
+}
+
+// rows returns the rows of the current view, sorted.
+func (m *model) rows() []row {
+	var rows []row
+	add := func(name, key string, children bool) {
+		if h, ok := m.scopes[key]; ok {
+			r := row{name: name, children: children}
+			r.cur, r.avg, r.max, r.calls = h.stats(m.frames, m.window)
+			rows = append(rows, r)
+		}
+	}
+
+	if m.flat {
+		for key := range m.scopes {
+			if strings.HasPrefix(key, flatPrefix) {
+				add(key[len(flatPrefix):], key, false)
+			}
+		}
+	} else {
+		parent := m.pathKey()
+		for name := range m.children[parent] {
+			key := parent + pathSeparator + name
+			_, children := m.children[key]
+			add(name, key, children)
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		switch m.sortBy {
+		case sortCurrent:
+			if a.cur != b.cur {
+				return a.cur > b.cur
+			}
+		case sortMax:
+			if a.max != b.max {
+				return a.max > b.max
+			}
+		case sortAvg:
+			if a.avg != b.avg {
+				return a.avg > b.avg
+			}
+		}
+		return a.name < b.name
+	})
+	return rows
+}
+
+// cycleThread switches between all threads and each known thread.
+func (m *model) cycleThread() {
+	ids := make([]uint32, 0, len(m.threads))
+	for id := range m.threads {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	next := -1
+	if m.filtered {
+		for i, id := range ids {
+			if id == m.thread {
+				next = i
+			}
+		}
+	}
+
+	if next++; next < len(ids) {
+		m.thread, m.filtered = ids[next], true
+	} else {
+		m.filtered = false
+	}
+	m.reset()
+	m.selected = 0
+}
+
+func (m *model) threadName() string {
+	if !m.filtered {
+		return "all threads"
+	}
+	return m.threads[m.thread]
+}
+
+func (m *model) enter(rows []row) {
+	if m.flat || m.selected >= len(rows) || !rows[m.selected].children {
+		return
+	}
+	m.path = append(m.path, rows[m.selected].name)
+	m.selected = 0
+}
+
+func (m *model) leave() {
+	if len(m.path) > 0 {
+		m.path = m.path[:len(m.path)-1]
+		m.selected = 0
+	}
+}
@@ -0,0 +1,225 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/consoletest/profiletest"
+)
+
+// testFrame has a main thread running update, which recurses once, and
+// render, and a worker thread running a job.
+func testFrame(update float64) *console.ProfilerFrame {
+	return console.BuildFrame([]console.ResolvedEvent{
+		profiletest.Event("frame", "main", 1, -1, 0, 10),
+		profiletest.Event("update", "main", 1, 0, 0, update),
+		profiletest.Event("update", "main", 1, 1, 0, update/2),
+		profiletest.Event("render", "main", 1, 0, 0, 3),
+		profiletest.Event("job", "worker", 2, -1, 0, 2),
+	})
+}
+
+func rowNames(rows []row) []string {
+	var names []string
+	for _, r := range rows {
+		names = append(names, r.name)
+	}
+	return names
+}
+
+func TestHistory(t *testing.T) {
+	var h history
+	for f := 1; f <= 5; f++ {
+		h.add(f, float64(f), f, 3)
+	}
+	if !reflect.DeepEqual(h.frames, []int{4, 5, 3}) || !reflect.DeepEqual(h.values, []float64{4, 5, 3}) {
+		t.Fatalf("unexpected ring: %v %v", h.frames, h.values)
+	}
+
+	cur, avg, max, calls := h.stats(5, 3)
+	if cur != 5 || avg != 4 || max != 5 || calls != 5 {
+		t.Errorf("unexpected stats: %v %v %v %v", cur, avg, max, calls)
+	}
+
+	// Frames where the scope was absent count neither as current nor in the average.
+	cur, avg, max, _ = h.stats(6, 3)
+	if cur != 0 || avg != 4.5 || max != 5 {
+		t.Errorf("unexpected stats: %v %v %v", cur, avg, max)
+	}
+	if cur, avg, _, _ := h.stats(10, 3); cur != 0 || avg != 0 {
+		t.Errorf("unexpected stats outside window: %v %v", cur, avg)
+	}
+}
+
+func TestModelRows(t *testing.T) {
+	m := newModel(2)
+	m.addFrame(testFrame(2))
+	m.addFrame(testFrame(4))
+	m.addFrame(testFrame(6))
+
+	if len(m.frameTimes) != 3 {
+		t.Errorf("unexpected frame times: %v", m.frameTimes)
+	}
+
+	rows := m.rows()
+	if names := rowNames(rows); !reflect.DeepEqual(names, []string{"frame", "job"}) {
+		t.Fatalf("unexpected rows: %v", names)
+	}
+	if r := rows[0]; r.cur != 10 || r.avg != 10 || !r.children {
+		t.Errorf("unexpected frame row: %+v", r)
+	}
+
+	m.path = []string{"frame"}
+	rows = m.rows()
+	if names := rowNames(rows); !reflect.DeepEqual(names, []string{"update", "render"}) {
+		t.Fatalf("unexpected rows: %v", names)
+	}
+	if r := rows[0]; r.cur != 6 || r.avg != 5 || r.max != 6 || r.calls != 1 {
+		t.Errorf("unexpected update row: %+v", r)
+	}
+
+	m.sortBy = sortName
+	if names := rowNames(m.rows()); !reflect.DeepEqual(names, []string{"render", "update"}) {
+		t.Errorf("unexpected name order: %v", names)
+	}
+
+	// Flat scopes count recursion once in time, but every call.
+	m.flat = true
+	rows = m.rows()
+	if names := rowNames(rows); !reflect.DeepEqual(names, []string{"frame", "job", "render", "update"}) {
+		t.Fatalf("unexpected flat rows: %v", names)
+	}
+	if r := rows[3]; r.cur != 6 || r.calls != 2 {
+		t.Errorf("unexpected flat update row: %+v", r)
+	}
+}
+
+func TestModelSort(t *testing.T) {
+	m := newModel(2)
+	m.path = []string{"frame"}
+	m.addFrame(testFrame(8))
+	m.addFrame(testFrame(1))
+
+	tests := []struct {
+		sortBy   int
+		expected []string
+	}{
+		{sortCurrent, []string{"render", "update"}},
+		{sortAvg, []string{"update", "render"}},
+		{sortMax, []string{"update", "render"}},
+		{sortName, []string{"render", "update"}},
+	}
+	for _, test := range tests {
+		m.sortBy = test.sortBy
+		if names := rowNames(m.rows()); !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("sort by %s: unexpected order: %v", sortNames[test.sortBy], names)
+		}
+	}
+}
+
+func TestModelDrillDown(t *testing.T) {
+	m := newModel(4)
+	m.addFrame(testFrame(4))
+
+	m.enter(m.rows())
+	if !reflect.DeepEqual(m.path, []string{"frame"}) {
+		t.Fatalf("unexpected path: %v", m.path)
+	}
+
+	// render has no children.
+	m.selected = 1
+	m.enter(m.rows())
+	if len(m.path) != 1 || m.selected != 1 {
+		t.Errorf("entered leaf: %v", m.path)
+	}
+
+	m.selected = 0
+	m.enter(m.rows())
+	if !reflect.DeepEqual(m.path, []string{"frame", "update"}) || m.selected != 0 {
+		t.Fatalf("unexpected path: %v", m.path)
+	}
+	if names := rowNames(m.rows()); !reflect.DeepEqual(names, []string{"update"}) {
+		t.Errorf("unexpected rows: %v", names)
+	}
+
+	m.leave()
+	m.leave()
+	m.leave()
+	if len(m.path) != 0 {
+		t.Errorf("unexpected path: %v", m.path)
+	}
+
+	m.flat = true
+	m.enter(m.rows())
+	if len(m.path) != 0 {
+		t.Errorf("entered flat scope: %v", m.path)
+	}
+}
+
+func TestModelCycleThread(t *testing.T) {
+	m := newModel(4)
+	m.addFrame(testFrame(2))
+
+	var names []string
+	for i := 0; i < 3; i++ {
+		m.cycleThread()
+		names = append(names, m.threadName())
+	}
+	if !reflect.DeepEqual(names, []string{"main", "worker", "all threads"}) {
+		t.Errorf("unexpected threads: %v", names)
+	}
+
+	m.cycleThread()
+	if len(m.scopes) != 0 {
+		t.Error("scopes not reset")
+	}
+	m.addFrame(testFrame(2))
+	if names := rowNames(m.rows()); !reflect.DeepEqual(names, []string{"frame"}) {
+		t.Errorf("unexpected rows for main: %v", names)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := map[string]string{
+		"frame":   "frame",
+		"update":  "updat",
+		"ÅÄÖåäö":  "ÅÄÖåä",
+		"日本語テキスト": "日本語テキ",
+	}
+	for name, expected := range tests {
+		if s := truncate(name, 5); s != expected || !utf8.ValidString(s) {
+			t.Errorf("%s: expected %q, got %q", name, expected, s)
+		}
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	times := []float64{1, 2, 4, 8}
+	if s := sparkline(times, 2); utf8.RuneCountInString(s) != 2 || []rune(s)[1] != sparkRunes[len(sparkRunes)-1] {
+		t.Errorf("unexpected sparkline: %q", s)
+	}
+	for _, width := range []int{0, -1} {
+		if s := sparkline(times, width); s != "" {
+			t.Errorf("width %d: unexpected sparkline: %q", width, s)
+		}
+	}
+}
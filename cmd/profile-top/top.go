@@ -0,0 +1,352 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/target"
+	"github.com/jroimartin/gocui"
+)
+
+const helpText = " q quit  p pause  s sort  t thread  f flat  enter drill down  backspace up"
+
+var sparkRunes = []rune("▁▂▃▄▅▆▇█")
+
+var arguments struct {
+	hostAddress,
+	targetName,
+	command string
+	window  int
+	refresh time.Duration
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Printf("Usage: profile-top [options]\n\n")
+		flag.PrintDefaults()
+	}
+
+	flag.StringVar(&arguments.hostAddress, "host", "", "host address, address:[port] (default localhost, or the host of -target)")
+	flag.StringVar(&arguments.targetName, "target", "", "named target from "+target.DefaultPath())
+	flag.StringVar(&arguments.command, "command", "", "console command sent on connect, e.g. to enable the profiler")
+	flag.IntVar(&arguments.window, "window", 120, "number of frames used for average and max")
+	flag.DurationVar(&arguments.refresh, "refresh", 250*time.Millisecond, "screen refresh interval")
+}
+
+func errorln(msg ...interface{}) {
+	fmt.Fprintln(os.Stderr, msg...)
+	os.Exit(-1)
+}
+
+func assertln(err error, msg ...interface{}) {
+	if err != nil {
+		errorln(msg...)
+	}
+}
+
+func sparkline(times []float64, width int) string {
+	if width < 0 {
+		width = 0
+	}
+	if len(times) > width {
+		times = times[len(times)-width:]
+	}
+
+	var max float64
+	for _, t := range times {
+		if t > max {
+			max = t
+		}
+	}
+
+	var buf strings.Builder
+	for _, t := range times {
+		i := 0
+		if max > 0 {
+			i = int(t / max * float64(len(sparkRunes)-1))
+		}
+		buf.WriteRune(sparkRunes[i])
+	}
+	return buf.String()
+}
+
+// truncate cuts name to at most width runes.
+func truncate(name string, width int) string {
+	if runes := []rune(name); len(runes) > width {
+		return string(runes[:width])
+	}
+	return name
+}
+
+func ms(seconds float64) float64 {
+	return seconds * 1000
+}
+
+func drawHeader(v *gocui.View, m *model, host string, status string) {
+	v.Clear()
+	width, _ := v.Size()
+
+	var cur, avg float64
+	if n := len(m.frameTimes); n > 0 {
+		cur = m.frameTimes[n-1]
+		window := m.frameTimes
+		if len(window) > m.window {
+			window = window[len(window)-m.window:]
+		}
+		for _, t := range window {
+			avg += t
+		}
+		avg /= float64(len(window))
+	}
+
+	state := status
+	if m.paused {
+		state = "paused"
+	}
+
+	path := "/"
+	if m.flat {
+		path = "flat"
+	} else if len(m.path) > 0 {
+		path = "/" + strings.Join(m.path, "/")
+	}
+
+	fmt.Fprintf(v, " %s  frame %d  %.2f ms (avg %.2f ms)  %s  sort: %s  %s\n",
+		state, m.frames, ms(cur), ms(avg), m.threadName(), sortNames[m.sortBy], path)
+	fmt.Fprintf(v, " %s", sparkline(m.frameTimes, width-2))
+	v.Title = host
+}
+
+func drawTable(v *gocui.View, m *model, rows []row) error {
+	v.Clear()
+	width, height := v.Size()
+
+	nameWidth := width - 44
+	if nameWidth < 10 {
+		nameWidth = 10
+	}
+	fmt.Fprintf(v, "%-*s %10s %10s %10s %8s\n", nameWidth, "scope", "cur ms", "avg ms", "max ms", "calls")
+
+	if m.selected >= len(rows) {
+		m.selected = len(rows) - 1
+	}
+	if m.selected < 0 {
+		m.selected = 0
+	}
+
+	for _, r := range rows {
+		name := r.name
+		if r.children {
+			name = "+ " + name
+		} else {
+			name = "  " + name
+		}
+		fmt.Fprintf(v, "%-*s %10.3f %10.3f %10.3f %8d\n", nameWidth, truncate(name, nameWidth), ms(r.cur), ms(r.avg), ms(r.max), r.calls)
+	}
+
+	// Row zero is the column header.
+	_, oy := v.Origin()
+	y := m.selected + 1
+	if y-oy >= height {
+		oy = y - height + 1
+	} else if y-oy < 1 {
+		oy = y - 1
+	}
+	if err := v.SetOrigin(0, oy); err != nil {
+		return err
+	}
+	return v.SetCursor(0, y-oy)
+}
+
+type app struct {
+	gui    *gocui.Gui
+	model  *model
+	host   string
+	status string
+}
+
+func (a *app) layout(g *gocui.Gui) error {
+	maxX, maxY := g.Size()
+
+	if v, err := g.SetView("header", 0, 0, maxX-1, 3); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.FgColor = gocui.ColorWhite
+	}
+
+	if v, err := g.SetView("table", 0, 4, maxX-1, maxY-2); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.FgColor = gocui.ColorWhite
+		v.SelBgColor = gocui.ColorCyan
+		v.SelFgColor = gocui.ColorBlack
+		v.Highlight = true
+		if _, err := g.SetCurrentView("table"); err != nil {
+			return err
+		}
+	}
+
+	if v, err := g.SetView("help", -1, maxY-2, maxX, maxY); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Frame = false
+		v.FgColor = gocui.ColorWhite
+		fmt.Fprint(v, helpText)
+	}
+
+	return a.draw(g)
+}
+
+func (a *app) draw(g *gocui.Gui) error {
+	a.model.lock.Lock()
+	defer a.model.lock.Unlock()
+
+	header, err := g.View("header")
+	if err != nil {
+		return err
+	}
+	drawHeader(header, a.model, a.host, a.status)
+
+	table, err := g.View("table")
+	if err != nil {
+		return err
+	}
+	return drawTable(table, a.model, a.model.rows())
+}
+
+// bind registers a key that updates the model and redraws.
+func (a *app) bind(key interface{}, fn func(m *model)) {
+	assertln(a.gui.SetKeybinding("", key, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+		a.model.lock.Lock()
+		fn(a.model)
+		a.model.lock.Unlock()
+		return a.draw(g)
+	}), "could not bind key")
+}
+
+func (a *app) setupKeybindings() {
+	quit := func(*gocui.Gui, *gocui.View) error {
+		return gocui.ErrQuit
+	}
+	assertln(a.gui.SetKeybinding("", gocui.KeyCtrlC, gocui.ModNone, quit), "could not bind key")
+	assertln(a.gui.SetKeybinding("", 'q', gocui.ModNone, quit), "could not bind key")
+
+	a.bind('p', func(m *model) { m.paused = !m.paused })
+	a.bind('s', func(m *model) { m.sortBy = (m.sortBy + 1) % numSortModes })
+	a.bind('t', func(m *model) { m.cycleThread() })
+	a.bind('f', func(m *model) {
+		m.flat = !m.flat
+		m.selected = 0
+	})
+	a.bind(gocui.KeyArrowUp, func(m *model) { m.selected-- })
+	a.bind(gocui.KeyArrowDown, func(m *model) { m.selected++ })
+	a.bind(gocui.KeyEnter, func(m *model) { m.enter(m.rows()) })
+	a.bind(gocui.KeyArrowRight, func(m *model) { m.enter(m.rows()) })
+	a.bind(gocui.KeyBackspace, func(m *model) { m.leave() })
+	a.bind(gocui.KeyBackspace2, func(m *model) { m.leave() })
+	a.bind(gocui.KeyArrowLeft, func(m *model) { m.leave() })
+}
+
+func (a *app) setStatus(status string) {
+	a.gui.Update(func(g *gocui.Gui) error {
+		a.status = status
+		return a.draw(g)
+	})
+}
+
+// stream feeds frames from the profiler to the model until ctx is cancelled.
+func (a *app) stream(ctx context.Context, tgt *target.Target) {
+	a.setStatus("connecting")
+	con, err := tgt.Connect()
+	if err != nil {
+		a.setStatus("could not connect")
+		return
+	}
+	defer con.Close()
+
+	if arguments.command != "" {
+		if err := con.SendCommand(console.Command, arguments.command); err != nil {
+			a.setStatus(err.Error())
+			return
+		}
+	}
+	a.setStatus("live")
+
+	prof := console.NewProfiler(con)
+	prof.Start(ctx)
+
+	for events := range prof.Events() {
+		frame := console.BuildFrame(prof.Tables().Resolve(events))
+		a.model.addFrame(frame)
+	}
+
+	if err := prof.Err(); err != nil {
+		a.setStatus("disconnected: " + err.Error())
+	}
+}
+
+func main() {
+	flag.Parse()
+	if arguments.window < 1 {
+		errorln("invalid window size")
+	}
+
+	tgt, err := target.FromFlags(arguments.targetName, arguments.hostAddress)
+	if err != nil {
+		errorln(err)
+	}
+	gui, err := gocui.NewGui(gocui.OutputNormal)
+	assertln(err, err)
+	defer gui.Close()
+
+	a := &app{gui: gui, model: newModel(arguments.window), host: tgt.Address()}
+	gui.SetManagerFunc(a.layout)
+	a.setupKeybindings()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.stream(ctx, tgt)
+
+	go func() {
+		ticker := time.NewTicker(arguments.refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				gui.Update(a.draw)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if err := gui.MainLoop(); err != nil && err != gocui.ErrQuit {
+		gui.Close()
+		errorln(err)
+	}
+}
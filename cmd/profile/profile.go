@@ -0,0 +1,224 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/flamegraph"
+	"github.com/andreas-jonsson/go-stingray/console/pprof"
+	"github.com/andreas-jonsson/go-stingray/console/target"
+	"github.com/andreas-jonsson/go-stingray/console/trace"
+)
+
+var arguments struct {
+	hostAddress,
+	targetName,
+	outputPath,
+	inputPath,
+	format,
+	command string
+	frames int
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Printf("Usage: profile [options]\n\n")
+		flag.PrintDefaults()
+	}
+
+	flag.StringVar(&arguments.hostAddress, "host", "", "host address, address:[port] (default localhost, or the host of -target)")
+	flag.StringVar(&arguments.targetName, "target", "", "named target from "+target.DefaultPath())
+	flag.StringVar(&arguments.outputPath, "o", "trace.json", "write profile to file")
+	flag.StringVar(&arguments.inputPath, "i", "", "read frames from a capture file instead of the engine")
+	flag.StringVar(&arguments.format, "format", "", "output format, (trace, pprof, capture, flamegraph, icicle), default from file extension")
+	flag.IntVar(&arguments.frames, "frames", 60, "number of frames to capture, 0 reads all frames from -i")
+	flag.StringVar(&arguments.command, "command", "", "console command sent before capturing, e.g. to enable the profiler")
+}
+
+func errorln(msg ...interface{}) {
+	fmt.Fprintln(os.Stderr, msg...)
+	os.Exit(-1)
+}
+
+func assertln(err error, msg ...interface{}) {
+	if err != nil {
+		errorln(msg...)
+	}
+}
+
+// frameWriter is implemented by each output format.
+type frameWriter interface {
+	WriteFrame(frame *console.ProfilerFrame) error
+	Close() error
+}
+
+type frameSource interface {
+	NextFrame() (*console.ProfilerFrame, error)
+}
+
+type pprofWriter struct {
+	builder *pprof.Builder
+	file    *os.File
+}
+
+func (w *pprofWriter) WriteFrame(frame *console.ProfilerFrame) error {
+	w.builder.AddFrame(frame)
+	return nil
+}
+
+func (w *pprofWriter) Close() error {
+	return w.builder.Write(w.file)
+}
+
+type flameWriter struct {
+	graph   *flamegraph.Graph
+	options flamegraph.Options
+	file    *os.File
+}
+
+func (w *flameWriter) WriteFrame(frame *console.ProfilerFrame) error {
+	w.graph.AddFrame(frame)
+	return nil
+}
+
+func (w *flameWriter) Close() error {
+	return w.graph.WriteSVG(w.file, w.options)
+}
+
+// captureWriter stores the raw events through the session, since frames
+// do not keep the original event order.
+type captureWriter struct {
+	*console.CaptureWriter
+}
+
+func (w captureWriter) WriteFrame(frame *console.ProfilerFrame) error {
+	return nil
+}
+
+func outputFormat() string {
+	if arguments.format != "" {
+		return arguments.format
+	}
+
+	switch path := arguments.outputPath; {
+	case strings.HasSuffix(path, ".pb.gz"), strings.HasSuffix(path, ".pprof"):
+		return "pprof"
+	case strings.HasSuffix(path, ".srcap"):
+		return "capture"
+	case strings.HasSuffix(path, ".svg"):
+		return "flamegraph"
+	default:
+		return "trace"
+	}
+}
+
+func newFrameWriter(fp *os.File, process string, session *console.ProfilerSession) frameWriter {
+	switch format := outputFormat(); format {
+	case "trace":
+		writer, err := trace.NewWriter(fp)
+		assertln(err, err)
+		writer.Process = process
+		return writer
+	case "pprof":
+		builder := pprof.NewBuilder()
+		builder.Start = time.Now()
+		return &pprofWriter{builder, fp}
+	case "flamegraph", "icicle":
+		options := flamegraph.Options{Title: process, Icicle: format == "icicle"}
+		return &flameWriter{flamegraph.New(), options, fp}
+	case "capture":
+		if session == nil {
+			errorln("capture output requires a live engine")
+		}
+		writer, err := console.NewCaptureWriter(fp, session.ProfilerTables)
+		assertln(err, err)
+		session.Capture(writer)
+		return captureWriter{writer}
+	default:
+		errorln("invalid format: " + format)
+		return nil
+	}
+}
+
+func openSource() (frameSource, *console.ProfilerSession, string, func()) {
+	if arguments.inputPath != "" {
+		fp, err := os.Open(arguments.inputPath)
+		assertln(err, err)
+
+		reader, err := console.NewCaptureReader(fp)
+		assertln(err, "could not read capture: "+arguments.inputPath)
+		return reader, nil, arguments.inputPath, func() { fp.Close() }
+	}
+
+	if arguments.frames < 1 {
+		errorln("invalid number of frames")
+	}
+
+	tgt, err := target.FromFlags(arguments.targetName, arguments.hostAddress)
+	if err != nil {
+		errorln(err)
+	}
+	fmt.Printf("connecting to %s...\n", tgt.Address())
+	con, err := tgt.Connect()
+	assertln(err, "could not connect to: "+tgt.Address())
+
+	if arguments.command != "" {
+		err := con.SendCommand(console.Command, arguments.command)
+		assertln(err, err)
+	}
+
+	session := console.NewProfilerSession(con)
+	return session, session, tgt.Address(), con.Close
+}
+
+func main() {
+	flag.Parse()
+
+	source, session, name, closeSource := openSource()
+	defer closeSource()
+
+	fp, err := os.Create(arguments.outputPath)
+	assertln(err, err)
+	defer fp.Close()
+
+	writer := newFrameWriter(fp, name, session)
+
+	for i := 0; arguments.frames < 1 || i < arguments.frames; i++ {
+		frame, err := source.NextFrame()
+		if err == io.EOF && session == nil {
+			break
+		}
+		assertln(err, err)
+
+		err = writer.WriteFrame(frame)
+		assertln(err, err)
+		fmt.Printf("\rframe %d", i+1)
+	}
+	fmt.Println()
+
+	err = writer.Close()
+	assertln(err, err)
+	fmt.Println("output written to: " + arguments.outputPath)
+}
@@ -28,11 +28,13 @@ import (
 	"time"
 
 	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/target"
 	"github.com/andreas-jonsson/go-stingray/sjson"
 )
 
 var arguments struct {
 	hostAddress,
+	targetName,
 	outputPath string
 	scale int
 }
@@ -43,7 +45,8 @@ func init() {
 		flag.PrintDefaults()
 	}
 
-	flag.StringVar(&arguments.hostAddress, "host", "localhost", "host address, address:[port]")
+	flag.StringVar(&arguments.hostAddress, "host", "", "host address, address:[port] (default localhost, or the host of -target)")
+	flag.StringVar(&arguments.targetName, "target", "", "named target from "+target.DefaultPath())
 	flag.StringVar(&arguments.outputPath, "output", "screenshot.png", "write image to file")
 	flag.IntVar(&arguments.scale, "scale", 1, "screen-buffer multiplier")
 
@@ -57,7 +60,7 @@ func errorln(msg ...interface{}) {
 
 func assertln(err error, msg ...interface{}) {
 	if err != nil {
-		errorln(msg)
+		errorln(msg...)
 	}
 }
 
@@ -69,30 +72,15 @@ func transferThumbnail(con *console.Console, writer io.Writer, id int) {
 	}()
 
 	for {
-		_, data, err := con.Receive()
+		obj, payload, err := con.ReceiveBinary()
 		assertln(err, err)
 
-		if len(data) == 0 {
-			continue
-		}
-
-		lex := sjson.NewLexer(bytes.NewBuffer(data))
-		obj, err := sjson.Decode(lex)
-		assertln(err, err)
-
-		reader := lex.Reader()
-		b, err := reader.ReadByte()
-		assertln(err, err)
-		if b != 0 {
-			errorln("invalid binary message")
-		}
-
 		m := obj.(map[string]sjson.Value)
 		if m["type"].(string) != "thumbnail" || int(m["id"].(float64)) != id {
 			continue
 		}
 
-		_, err = reader.WriteTo(writer)
+		_, err = io.Copy(writer, payload)
 		assertln(err, err)
 		return
 	}
@@ -107,15 +95,7 @@ func transferJittered(con *console.Console) *frameCapture {
 
 	var capture *frameCapture
 	for capture == nil || !capture.isComplete() {
-		_, data, err := con.Receive()
-		assertln(err, err)
-
-		if len(data) == 0 {
-			continue
-		}
-
-		lex := sjson.NewLexer(bytes.NewBuffer(data))
-		obj, err := sjson.Decode(lex)
+		obj, payload, err := con.ReceiveBinary()
 		assertln(err, err)
 
 		m := obj.(map[string]sjson.Value)
@@ -123,13 +103,6 @@ func transferJittered(con *console.Console) *frameCapture {
 			continue
 		}
 
-		reader := lex.Reader()
-		b, err := reader.ReadByte()
-		assertln(err, err)
-		if b != 0 {
-			errorln("invalid binary message")
-		}
-
 		id := int(m["id"].(float64))
 		tap := int(m["tap"].(float64))
 		format, _ := m["surface_format"].(string)
@@ -147,7 +120,7 @@ func transferJittered(con *console.Console) *frameCapture {
 		fmt.Printf("tap %v/%v\n", tap, capture.numTaps)
 
 		var buf bytes.Buffer
-		_, err = reader.WriteTo(&buf)
+		_, err = buf.ReadFrom(payload)
 		assertln(err, err)
 
 		if err := capture.addTap(tap, buf.Bytes()); err != nil {
@@ -167,9 +140,13 @@ func main() {
 		errorln("invalid scale value")
 	}
 
-	fmt.Printf("connecting to %s...\n", arguments.hostAddress)
-	con, err := console.NewConsole(arguments.hostAddress, "")
-	assertln(err, "could not connect to: "+arguments.hostAddress)
+	tgt, err := target.FromFlags(arguments.targetName, arguments.hostAddress)
+	if err != nil {
+		errorln(err)
+	}
+	fmt.Printf("connecting to %s...\n", tgt.Address())
+	con, err := tgt.Connect()
+	assertln(err, "could not connect to: "+tgt.Address())
 	defer con.Close()
 
 	fmt.Println("connected")
@@ -0,0 +1,147 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+var ErrInvalidBinaryMessage = errors.New("invalid binary message")
+
+// SplitBinary splits a binary frame into its SJSON header and the payload
+// following the zero byte separator. The payload is a slice of data.
+func SplitBinary(data []byte) (sjson.Value, []byte, error) {
+	dec := decoderPool.Get().(*frameDecoder)
+	defer decoderPool.Put(dec)
+	return dec.splitBinary(data)
+}
+
+// DecodeBinary is like SplitBinary but returns the payload as a reader.
+func DecodeBinary(data []byte) (sjson.Value, io.Reader, error) {
+	header, payload, err := SplitBinary(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, bytes.NewReader(payload), nil
+}
+
+// ReceiveBinary returns the next binary frame, skipping text frames.
+func (con *Console) ReceiveBinary() (sjson.Value, io.Reader, error) {
+	for {
+		_, data, err := con.Receive()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(data) > 0 {
+			header, payload, err := con.decoder.splitBinary(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			return header, bytes.NewReader(payload), nil
+		}
+	}
+}
+
+type (
+	MessageHandler func(msg sjson.Value) error
+	BinaryHandler  func(header sjson.Value, payload io.Reader) error
+
+	// UnhandledHandler receives frames without a registered handler, including
+	// binary frames without a header. Either val or data is set.
+	UnhandledHandler func(val sjson.Value, data []byte) error
+)
+
+// Router dispatches frames from a console connection to handlers
+// registered by message type.
+type Router struct {
+	con       *Console
+	text      map[string]MessageHandler
+	binary    map[string]BinaryHandler
+	unhandled UnhandledHandler
+}
+
+func (r *Router) Handle(ty string, h MessageHandler) {
+	r.text[ty] = h
+}
+
+func (r *Router) HandleBinary(ty string, h BinaryHandler) {
+	r.binary[ty] = h
+}
+
+func (r *Router) HandleUnhandled(h UnhandledHandler) {
+	r.unhandled = h
+}
+
+func (r *Router) fallback(val sjson.Value, data []byte) error {
+	if r.unhandled != nil {
+		return r.unhandled(val, data)
+	}
+	return nil
+}
+
+func messageType(val sjson.Value) string {
+	if m, ok := val.(map[string]sjson.Value); ok {
+		ty, _ := m["type"].(string)
+		return ty
+	}
+	return ""
+}
+
+// Dispatch routes a single frame, as returned by Console.Receive.
+func (r *Router) Dispatch(val sjson.Value, data []byte) error {
+	if len(data) == 0 {
+		if h, ok := r.text[messageType(val)]; ok {
+			return h(val)
+		}
+		return r.fallback(val, nil)
+	}
+
+	if len(r.binary) > 0 {
+		if header, payload, err := DecodeBinary(data); err == nil {
+			if h, ok := r.binary[messageType(header)]; ok {
+				return h(header, payload)
+			}
+		}
+	}
+	return r.fallback(nil, data)
+}
+
+// Run receives and dispatches frames until the connection or a handler fails.
+func (r *Router) Run() error {
+	for {
+		val, data, err := r.con.Receive()
+		if err != nil {
+			return err
+		}
+		if err := r.Dispatch(val, data); err != nil {
+			return err
+		}
+	}
+}
+
+func NewRouter(con *Console) *Router {
+	return &Router{
+		con:    con,
+		text:   make(map[string]MessageHandler),
+		binary: make(map[string]BinaryHandler),
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+func TestDecodeBinary(t *testing.T) {
+	header, payload, err := DecodeBinary([]byte("{type=\"thumbnail\" id=1}\x00\x01\x02"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(header, map[string]sjson.Value{"type": "thumbnail", "id": 1.0}) {
+		t.Errorf("unexpected header: %v", header)
+	}
+
+	if data, _ := ioutil.ReadAll(payload); !reflect.DeepEqual(data, []byte{1, 2}) {
+		t.Errorf("unexpected payload: %v", data)
+	}
+
+	frame := []byte("{type=\"thumbnail\"}\x00\x01\x02")
+	if _, data, err := SplitBinary(frame); err != nil || &data[0] != &frame[len(frame)-2] {
+		t.Error("payload should be a slice of the frame")
+	}
+
+	for _, data := range []string{"{type=\"thumbnail\"}\x01\x02", "{type=\"thumbnail\"}", "\x00\x01", "\"str\"\x00"} {
+		if _, _, err := DecodeBinary([]byte(data)); err != ErrInvalidBinaryMessage {
+			t.Errorf("expected invalid message: %q", data)
+		}
+	}
+}
+
+func TestRouter(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+
+	errDone := errors.New("done")
+	router := NewRouter(con)
+
+	var (
+		logs    int
+		payload []byte
+		raw     []byte
+	)
+
+	router.Handle("message", func(msg sjson.Value) error {
+		logs++
+		return nil
+	})
+	router.HandleBinary("frame_capture", func(header sjson.Value, r io.Reader) error {
+		payload, _ = ioutil.ReadAll(r)
+		return nil
+	})
+	router.HandleUnhandled(func(val sjson.Value, data []byte) error {
+		raw = data
+		return errDone
+	})
+
+	engine.Log("info", "Lua", "hello")
+	engine.SendFrameCapture(1, 0, 1, 1, []byte{1, 2, 3, 4})
+	engine.SendProfilerEvents([]uint32{42})
+
+	if err := router.Run(); err != errDone {
+		t.Fatal(err)
+	}
+
+	if logs != 1 || !reflect.DeepEqual(payload, []byte{1, 2, 3, 4}) || !reflect.DeepEqual(raw, []byte{0, 0, 0, 42}) {
+		t.Errorf("unexpected dispatch: %v %v %v", logs, payload, raw)
+	}
+}
@@ -0,0 +1,352 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// A capture starts with captureMagic, a version byte and the start time in
+// unix nanoseconds, followed by blocks. Each block is a type byte, a uvarint
+// length and the payload. Table blocks hold a uvarint count followed by
+// uvarint ID, uvarint length and name for each entry, and apply to all
+// following frames. Event blocks are deflate compressed and hold a uvarint
+// frame count, then a uvarint event count and the 60 byte big-endian events
+// for each frame. The first two blocks are the string and thread tables.
+const (
+	captureMagic   = "SRPROCAP"
+	captureVersion = 1
+
+	captureStrings = 1
+	captureThreads = 2
+	captureEvents  = 3
+
+	DefaultCaptureBlockFrames = 16
+
+	// maxCaptureBlockSize bounds the compressed and decompressed size of a
+	// block. Writers flush early once a block reaches captureBlockFlushSize.
+	maxCaptureBlockSize   = 256 << 20
+	captureBlockFlushSize = 64 << 20
+)
+
+var ErrInvalidCapture = errors.New("invalid capture")
+
+type CaptureWriter struct {
+	// FramesPerBlock is the number of frames compressed together,
+	// zero or less writes every frame as a block.
+	FramesPerBlock int
+
+	writer     *bufio.Writer
+	start      time.Time
+	frames     int
+	block      bytes.Buffer
+	compressed bytes.Buffer
+	deflate    *flate.Writer
+	scratch    []byte
+	buf        [binary.MaxVarintLen64]byte
+}
+
+func putUvarint(w *bytes.Buffer, v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	w.Write(buf[:n])
+}
+
+func (cw *CaptureWriter) writeBlock(ty byte, data []byte) error {
+	if err := cw.writer.WriteByte(ty); err != nil {
+		return err
+	}
+
+	n := binary.PutUvarint(cw.buf[:], uint64(len(data)))
+	if _, err := cw.writer.Write(cw.buf[:n]); err != nil {
+		return err
+	}
+	_, err := cw.writer.Write(data)
+	return err
+}
+
+func (cw *CaptureWriter) writeTable(ty byte, names map[uint64]string) error {
+	var buf bytes.Buffer
+	putUvarint(&buf, uint64(len(names)))
+	for id, name := range names {
+		putUvarint(&buf, id)
+		putUvarint(&buf, uint64(len(name)))
+		buf.WriteString(name)
+	}
+	return cw.writeBlock(ty, buf.Bytes())
+}
+
+func (cw *CaptureWriter) AddStrings(names map[uint64]string) error {
+	return cw.writeTable(captureStrings, names)
+}
+
+func (cw *CaptureWriter) AddThreads(names map[uint32]string) error {
+	table := make(map[uint64]string, len(names))
+	for id, name := range names {
+		table[uint64(id)] = name
+	}
+	return cw.writeTable(captureThreads, table)
+}
+
+// WriteFrame adds one batch of events as a frame.
+func (cw *CaptureWriter) WriteFrame(events []ProfilerEvent) error {
+	putUvarint(&cw.block, uint64(len(events)))
+	cw.scratch = cw.scratch[:0]
+	for i := range events {
+		cw.scratch = events[i].appendBinary(cw.scratch)
+	}
+	cw.block.Write(cw.scratch)
+
+	if cw.frames++; cw.frames >= cw.FramesPerBlock || cw.block.Len() >= captureBlockFlushSize {
+		return cw.Flush()
+	}
+	return nil
+}
+
+// Flush writes pending frames as a block and flushes the underlying writer.
+func (cw *CaptureWriter) Flush() error {
+	if cw.frames > 0 {
+		cw.compressed.Reset()
+		cw.deflate.Reset(&cw.compressed)
+
+		var header bytes.Buffer
+		putUvarint(&header, uint64(cw.frames))
+		if _, err := cw.deflate.Write(header.Bytes()); err != nil {
+			return err
+		}
+		if _, err := cw.deflate.Write(cw.block.Bytes()); err != nil {
+			return err
+		}
+		if err := cw.deflate.Close(); err != nil {
+			return err
+		}
+
+		if err := cw.writeBlock(captureEvents, cw.compressed.Bytes()); err != nil {
+			return err
+		}
+		cw.block.Reset()
+		cw.frames = 0
+	}
+	return cw.writer.Flush()
+}
+
+// Close flushes the capture. It does not close the underlying writer.
+func (cw *CaptureWriter) Close() error {
+	return cw.Flush()
+}
+
+func (cw *CaptureWriter) Start() time.Time {
+	return cw.start
+}
+
+// NewCaptureWriter writes a capture header with the given tables, which may be nil.
+func NewCaptureWriter(writer io.Writer, tables *ProfilerTables) (*CaptureWriter, error) {
+	cw := &CaptureWriter{
+		FramesPerBlock: DefaultCaptureBlockFrames,
+		writer:         bufio.NewWriter(writer),
+		start:          time.Now(),
+	}
+
+	var err error
+	if cw.deflate, err = flate.NewWriter(&cw.compressed, flate.DefaultCompression); err != nil {
+		return nil, err
+	}
+
+	if _, err := cw.writer.WriteString(captureMagic); err != nil {
+		return nil, err
+	}
+	if err := cw.writer.WriteByte(captureVersion); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(cw.writer, binary.BigEndian, cw.start.UnixNano()); err != nil {
+		return nil, err
+	}
+
+	if tables == nil {
+		tables = NewProfilerTables()
+	}
+	if err := cw.AddStrings(tables.Strings()); err != nil {
+		return nil, err
+	}
+	if err := cw.AddThreads(tables.Threads()); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// CaptureReader reads frames from a capture, resolving names with the
+// tables stored in it.
+type CaptureReader struct {
+	*ProfilerTables
+
+	reader *bufio.Reader
+	start  time.Time
+	block  *bytes.Reader
+	frames uint64
+	index  int
+	events []ProfilerEvent
+}
+
+func (cr *CaptureReader) Start() time.Time {
+	return cr.start
+}
+
+func readTable(data []byte) (map[uint64]string, error) {
+	r := bytes.NewReader(data)
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, ErrInvalidCapture
+	}
+
+	names := make(map[uint64]string)
+	for i := uint64(0); i < count; i++ {
+		id, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, ErrInvalidCapture
+		}
+		size, err := binary.ReadUvarint(r)
+		if err != nil || size > uint64(r.Len()) {
+			return nil, ErrInvalidCapture
+		}
+
+		name := make([]byte, size)
+		r.Read(name)
+		names[id] = string(name)
+	}
+	return names, nil
+}
+
+func (cr *CaptureReader) readBlock() error {
+	ty, err := cr.reader.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	size, err := binary.ReadUvarint(cr.reader)
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	if size > maxCaptureBlockSize {
+		return ErrInvalidCapture
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(cr.reader, data); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+
+	switch ty {
+	case captureStrings:
+		names, err := readTable(data)
+		if err != nil {
+			return err
+		}
+		cr.AddStrings(names)
+	case captureThreads:
+		table, err := readTable(data)
+		if err != nil {
+			return err
+		}
+		names := make(map[uint32]string, len(table))
+		for id, name := range table {
+			names[uint32(id)] = name
+		}
+		cr.AddThreads(names)
+	case captureEvents:
+		inflate := io.LimitReader(flate.NewReader(bytes.NewReader(data)), maxCaptureBlockSize+1)
+		block, err := ioutil.ReadAll(inflate)
+		if err != nil || len(block) > maxCaptureBlockSize {
+			return ErrInvalidCapture
+		}
+		cr.block = bytes.NewReader(block)
+		if cr.frames, err = binary.ReadUvarint(cr.block); err != nil {
+			return ErrInvalidCapture
+		}
+	default:
+		return ErrInvalidCapture
+	}
+	return nil
+}
+
+// NextEvents returns the events of the next frame, or io.EOF at the end.
+// The slice is reused by the following call.
+func (cr *CaptureReader) NextEvents() ([]ProfilerEvent, error) {
+	for cr.frames == 0 {
+		if err := cr.readBlock(); err != nil {
+			return nil, err
+		}
+	}
+
+	count, err := binary.ReadUvarint(cr.block)
+	if err != nil || count > uint64(cr.block.Len())/ProfilerEventSize {
+		return nil, ErrInvalidCapture
+	}
+
+	data := make([]byte, count*ProfilerEventSize)
+	cr.block.Read(data)
+	cr.frames--
+
+	cr.events, err = decodeProfilerEvents(data, cr.events)
+	return cr.events, err
+}
+
+// Next returns the next frame resolved, or io.EOF at the end.
+func (cr *CaptureReader) Next() ([]ResolvedEvent, error) {
+	events, err := cr.NextEvents()
+	if err != nil {
+		return nil, err
+	}
+	return cr.Resolve(events), nil
+}
+
+func (cr *CaptureReader) NextFrame() (*ProfilerFrame, error) {
+	events, err := cr.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	frame := BuildFrame(events)
+	frame.Index = cr.index
+	cr.index++
+	return frame, nil
+}
+
+func NewCaptureReader(reader io.Reader) (*CaptureReader, error) {
+	cr := &CaptureReader{ProfilerTables: NewProfilerTables(), reader: bufio.NewReader(reader)}
+
+	magic := make([]byte, len(captureMagic)+1)
+	if _, err := io.ReadFull(cr.reader, magic); err != nil || string(magic[:len(captureMagic)]) != captureMagic {
+		return nil, ErrInvalidCapture
+	}
+	if magic[len(captureMagic)] != captureVersion {
+		return nil, ErrInvalidCapture
+	}
+
+	var start int64
+	if err := binary.Read(cr.reader, binary.BigEndian, &start); err != nil {
+		return nil, ErrInvalidCapture
+	}
+	cr.start = time.Unix(0, start)
+	return cr, nil
+}
@@ -0,0 +1,165 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestCapture(t *testing.T) {
+	tables := NewProfilerTables()
+	tables.AddStrings(map[uint64]string{1: "frame"})
+	tables.AddThreads(map[uint32]string{1: "main"})
+
+	var buf bytes.Buffer
+	cw, err := NewCaptureWriter(&buf, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw.FramesPerBlock = 2
+
+	frames := [][]ProfilerEvent{
+		{{Name: 1, ThreadID: 1, Parent: -1, Elapsed: 0.016}},
+		{{Name: 1, ThreadID: 1, Parent: -1, Time: 0.016, Elapsed: 0.017}, {Name: 2, ThreadID: 2, Parent: -1}},
+		{},
+	}
+
+	cw.WriteFrame(frames[0])
+	cw.AddStrings(map[uint64]string{2: "job"})
+	cw.AddThreads(map[uint32]string{2: "worker"})
+	cw.WriteFrame(frames[1])
+	cw.WriteFrame(frames[2])
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cr, err := NewCaptureReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cr.Start().UnixNano() != cw.Start().UnixNano() {
+		t.Errorf("unexpected start time: %v", cr.Start())
+	}
+
+	for i, expected := range frames {
+		events, err := cr.NextEvents()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != len(expected) || (len(events) > 0 && !reflect.DeepEqual(events, expected)) {
+			t.Errorf("frame %d: unexpected events: %+v", i, events)
+		}
+	}
+	if _, err := cr.Next(); err != io.EOF {
+		t.Errorf("expected end of capture, got: %v", err)
+	}
+
+	if name, _ := cr.ScopeName(2); name != "job" {
+		t.Errorf("unexpected scope name: %s", name)
+	}
+	if name, _ := cr.ThreadName(2); name != "worker" {
+		t.Errorf("unexpected thread name: %s", name)
+	}
+
+	if _, err := NewCaptureReader(bytes.NewReader([]byte("SRCONREC"))); err != ErrInvalidCapture {
+		t.Errorf("expected invalid capture, got: %v", err)
+	}
+}
+
+func TestCaptureCorrupt(t *testing.T) {
+	var header bytes.Buffer
+	cw, err := NewCaptureWriter(&header, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw.Close()
+
+	events := func(payload []byte) []byte {
+		var block bytes.Buffer
+		w, _ := flate.NewWriter(&block, flate.DefaultCompression)
+		w.Write(payload)
+		w.Close()
+
+		var buf bytes.Buffer
+		buf.WriteByte(captureEvents)
+		putUvarint(&buf, uint64(block.Len()))
+		buf.Write(block.Bytes())
+		return buf.Bytes()
+	}
+
+	var size, overflow bytes.Buffer
+	size.WriteByte(captureEvents)
+	putUvarint(&size, math.MaxUint64)
+
+	// One frame with an event count that wraps around when multiplied
+	// by the event size.
+	putUvarint(&overflow, 1)
+	putUvarint(&overflow, math.MaxUint64/ProfilerEventSize+1)
+	overflow.Write(make([]byte, ProfilerEventSize))
+
+	for i, block := range [][]byte{size.Bytes(), events(overflow.Bytes())} {
+		cr, err := NewCaptureReader(bytes.NewReader(append(append([]byte(nil), header.Bytes()...), block...)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cr.NextEvents(); err != ErrInvalidCapture {
+			t.Errorf("block %d: expected invalid capture, got: %v", i, err)
+		}
+	}
+}
+
+func TestSessionCapture(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+
+	session := NewProfilerSession(con)
+
+	var buf bytes.Buffer
+	cw, err := NewCaptureWriter(&buf, session.ProfilerTables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Capture(cw)
+
+	engine.SendProfilerStrings(map[uint64]string{1: "frame"})
+	engine.SendProfilerEvents([]ProfilerEvent{{Name: 1, Parent: -1, Elapsed: 0.016}})
+
+	if _, err := session.Next(); err != nil {
+		t.Fatal(err)
+	}
+	cw.Close()
+
+	cr, err := NewCaptureReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame, err := cr.NextFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frame.Find("frame")) != 1 {
+		t.Errorf("unexpected frame: %+v", frame.Threads)
+	}
+}
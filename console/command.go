@@ -0,0 +1,168 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"unicode"
+
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+var (
+	ErrUnterminatedQuote  = errors.New("unterminated quote")
+	ErrUnterminatedEscape = errors.New("unterminated escape")
+	ErrEmptyCommand       = errors.New("empty command")
+)
+
+// numberPattern matches plain decimal numbers, so words such as "nan",
+// "inf" or "0x10" are passed as strings.
+var numberPattern = regexp.MustCompile(`^[-+]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][-+]?[0-9]+)?$`)
+
+func parseNumber(s string) (float64, bool) {
+	if !numberPattern.MatchString(s) {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+// tokenize splits a command line on whitespace. Single quotes preserve
+// their content literally, double quotes allow backslash escapes.
+func tokenize(command string) ([]token, error) {
+	var (
+		tokens  []token
+		buf     bytes.Buffer
+		inToken bool
+		quoted  bool
+		quote   rune
+		escape  bool
+	)
+
+	for _, r := range command {
+		switch {
+		case escape:
+			buf.WriteRune(r)
+			escape = false
+		case r == '\\' && quote != '\'':
+			escape = true
+			inToken = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				buf.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			quoted = true
+			inToken = true
+		case unicode.IsSpace(r):
+			if inToken {
+				tokens = append(tokens, token{buf.String(), quoted})
+				buf.Reset()
+				inToken, quoted = false, false
+			}
+		default:
+			buf.WriteRune(r)
+			inToken = true
+		}
+	}
+
+	if escape {
+		return nil, ErrUnterminatedEscape
+	} else if quote != 0 {
+		return nil, ErrUnterminatedQuote
+	}
+
+	if inToken {
+		tokens = append(tokens, token{buf.String(), quoted})
+	}
+	return tokens, nil
+}
+
+// SplitCommand splits a command line into words using shell-like
+// quoting and escaping rules.
+func SplitCommand(command string) ([]string, error) {
+	tokens, err := tokenize(command)
+	if err != nil {
+		return nil, err
+	}
+
+	words := make([]string, len(tokens))
+	for i, t := range tokens {
+		words[i] = t.text
+	}
+	return words, nil
+}
+
+// ParseCommand splits a command line into a command name and typed arguments.
+// Unquoted decimal numbers and booleans are converted, everything else is a string.
+func ParseCommand(command string) (string, []sjson.Value, error) {
+	tokens, err := tokenize(command)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(tokens) == 0 {
+		return "", nil, ErrEmptyCommand
+	}
+
+	args := make([]sjson.Value, len(tokens)-1)
+	for i, t := range tokens[1:] {
+		args[i] = t.text
+		if t.quoted {
+			continue
+		}
+
+		switch t.text {
+		case "true":
+			args[i] = true
+		case "false":
+			args[i] = false
+		default:
+			if f, ok := parseNumber(t.text); ok {
+				args[i] = f
+			}
+		}
+	}
+	return tokens[0].text, args, nil
+}
+
+func commandArgsMessage(name string, args []sjson.Value) sjson.Value {
+	if args == nil {
+		args = []sjson.Value{}
+	}
+	return map[string]sjson.Value{"type": "command", "command": name, "arg": args}
+}
+
+// SendCommandArgs sends a console command with typed arguments.
+func (con *Console) SendCommandArgs(name string, args ...sjson.Value) error {
+	return con.Send(commandArgsMessage(name, args))
+}
@@ -0,0 +1,98 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected []string
+	}{
+		{"test arg1  arg2", []string{"test", "arg1", "arg2"}},
+		{`  say "hello world" 'it''s' `, []string{"say", "hello world", "its"}},
+		{`say "a \"quoted\" word"`, []string{"say", `a "quoted" word`}},
+		{`say 'no \escape' a\ b ""`, []string{"say", `no \escape`, "a b", ""}},
+		{"", nil},
+	}
+
+	for _, test := range tests {
+		words, err := SplitCommand(test.command)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(words) == 0 && len(test.expected) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(words, test.expected) {
+			t.Errorf("%q: expected %q, got %q", test.command, test.expected, words)
+		}
+	}
+
+	if _, err := SplitCommand(`say "hello`); err != ErrUnterminatedQuote {
+		t.Error("expected unterminated quote")
+	}
+	if _, err := SplitCommand(`say hello\`); err != ErrUnterminatedEscape {
+		t.Error("expected unterminated escape")
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	name, args, err := ParseCommand(`set_speed 1.5 true "2" name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []sjson.Value{1.5, true, "2", "name"}
+	if name != "set_speed" || !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected command: %v %v", name, args)
+	}
+
+	if _, _, err := ParseCommand("   "); err != ErrEmptyCommand {
+		t.Error("expected empty command")
+	}
+
+	_, args, err = ParseCommand("spawn nan inf Infinity 0x1p4 1_000 1e400 -2 .5 3. 1e-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []sjson.Value{"nan", "inf", "Infinity", "0x1p4", "1_000", "1e400", -2.0, 0.5, 3.0, 0.001}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected arguments: %v", args)
+	}
+}
+
+func TestSendCommandArgs(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+	engine.Echo = true
+
+	if err := con.SendCommandArgs("test", 1, false, "a b"); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []sjson.Value{1.0, false, "a b"}
+	receiveAndTest(t, con, map[string]sjson.Value{"type": "command", "command": "test", "arg": args})
+}
@@ -21,9 +21,11 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/andreas-jonsson/go-stingray/sjson"
@@ -46,77 +48,55 @@ func marshalMessage(v interface{}) ([]byte, byte, error) {
 	return v.([]byte), websocket.TextFrame, nil
 }
 
-func unmarshalMessage(data []byte, ty byte, v interface{}) error {
-	switch ty {
-	case websocket.BinaryFrame:
-		return nil
-	case websocket.TextFrame:
-		var err error
-		lex := sjson.NewLexer(bytes.NewReader(data))
-
-		val, err := sjson.Decode(lex)
-		if err != nil {
-			return err
-		}
-
-		defer func() {
-			if r := recover(); r != nil {
-				err = errors.New("invalid message")
-			}
-		}()
-
-		msg := v.(*Message)
-		m := val.(map[string]sjson.Value)
-
-		if m["type"].(string) == "message" {
-			msg.System = m["system"].(string)
-			msg.Message = m["message"].(string)
-			msg.MessageType = m["message_type"].(string)
-			msg.Level = m["level"].(string)
-			return err
+func unmarshalMessage(val sjson.Value, msg *Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New("invalid message")
 		}
+	}()
 
-		return err
-	default:
-		return errors.New("unknown message")
+	m := val.(map[string]sjson.Value)
+	if m["type"].(string) == "message" {
+		msg.System = m["system"].(string)
+		msg.Message = m["message"].(string)
+		msg.MessageType = m["message_type"].(string)
+		// Levels the engine adds in the future are shown as info.
+		msg.Level, _ = ParseLevel(m["level"].(string))
+		msg.Time = time.Now()
 	}
+	return nil
 }
 
-func unmarshalFrameData(data []byte, ty byte, v interface{}) error {
-	fd := v.(*frameData)
-
-	switch ty {
-	case websocket.BinaryFrame:
-		fd.data = data
-	case websocket.TextFrame:
-		lex := sjson.NewLexer(bytes.NewReader(data))
-		val, err := sjson.Decode(lex)
-		if err != nil {
-			return err
-		}
-		fd.obj = val
-	default:
-		return errors.New("unknown message")
-	}
+func marshalRawFrame(v interface{}) ([]byte, byte, error) {
+	f := v.(*rawFrame)
+	return f.data, f.ty, nil
+}
 
+func unmarshalRawFrame(data []byte, ty byte, v interface{}) error {
+	f := v.(*rawFrame)
+	f.data = data
+	f.ty = ty
 	return nil
 }
 
 var (
-	consoleMessageCodec   = websocket.Codec{Marshal: marshalMessage, Unmarshal: unmarshalMessage}
-	consoleFrameDataCodec = websocket.Codec{Marshal: nil, Unmarshal: unmarshalFrameData}
+	consoleMessageCodec  = websocket.Codec{Marshal: marshalMessage}
+	consoleRawFrameCodec = websocket.Codec{Marshal: marshalRawFrame, Unmarshal: unmarshalRawFrame}
 )
 
-type frameData struct {
+type rawFrame struct {
 	data []byte
-	obj  sjson.Value
+	ty   byte
 }
 
 type Message struct {
 	System,
-	Level,
 	MessageType,
 	Message string
+
+	Level Level
+	// Time is when the message was received by the client.
+	Time time.Time
 }
 
 func (m Message) String() string {
@@ -128,64 +108,201 @@ func (m Message) String() string {
 }
 
 type Console struct {
-	lex  *sjson.Lexer
+	decoder frameDecoder
+
+	// rio guards reading frames into frame, which is reused for every frame.
+	rio   sync.Mutex
+	frame bytes.Buffer
+	limit io.LimitedReader
+
 	ws   *websocket.Conn
+	conn *liveConn
 	host string
+
+	// recordLock guards recorder, which may be changed while a frame is read.
+	recordLock sync.Mutex
+	recorder   *Recorder
+
+	// heartbeatLock guards heartbeat, the stop channel of the ping goroutine.
+	heartbeatLock sync.Mutex
+	heartbeat     chan struct{}
 }
 
+// Receive returns the next frame. Text frames are decoded to a value,
+// binary frames are returned as data. The data is owned by the caller.
 func (con *Console) Receive() (sjson.Value, []byte, error) {
-	fd := frameData{}
-	err := consoleFrameDataCodec.Receive(con.ws, &fd)
-	return fd.obj, fd.data, err
+	val, data, err := con.receive()
+	if data != nil {
+		data = append([]byte(nil), data...)
+	}
+	return val, data, err
 }
 
-func (con *Console) ReceiveMessage() (Message, error) {
-	var (
-		err error
-		msg Message
-	)
+// receive is like Receive, but binary data is only valid until the next
+// frame is read.
+func (con *Console) receive() (sjson.Value, []byte, error) {
+	data, binary, err := con.readFrame()
+	if err != nil {
+		return nil, nil, err
+	}
+	if binary {
+		return nil, data, nil
+	}
 
-	defer func() {
-		if r := recover(); r != nil {
-			err = errors.New("invalid message")
+	val, _, err := con.decoder.decode(data)
+	return val, nil, err
+}
+
+// Record writes all frames returned by Receive to rec. Pass nil to stop recording.
+func (con *Console) Record(rec *Recorder) {
+	con.recordLock.Lock()
+	con.recorder = rec
+	con.recordLock.Unlock()
+}
+
+// ReceiveRaw returns the next undecoded text or binary frame.
+// The data is owned by the caller.
+func (con *Console) ReceiveRaw() ([]byte, bool, error) {
+	data, binary, err := con.readFrame()
+	if err != nil {
+		return nil, false, err
+	}
+	return append([]byte(nil), data...), binary, nil
+}
+
+// readFrame reads the next data frame into the frame buffer, handling
+// control frames on the way. The data is only valid until the next call.
+func (con *Console) readFrame() ([]byte, bool, error) {
+	con.rio.Lock()
+	defer con.rio.Unlock()
+
+	for {
+		frame, err := con.ws.NewFrameReader()
+		if err != nil {
+			return nil, false, err
 		}
-	}()
+		if frame, err = con.ws.HandleFrame(frame); err != nil {
+			return nil, false, err
+		} else if frame == nil {
+			continue
+		}
+
+		max := int64(con.ws.MaxPayloadBytes)
+		if max == 0 {
+			max = websocket.DefaultMaxPayloadBytes
+		}
+
+		con.limit = io.LimitedReader{R: frame, N: max + 1}
+		con.frame.Reset()
+		_, err = con.frame.ReadFrom(&con.limit)
+		con.limit.R = nil
+		if err != nil {
+			return nil, false, err
+		}
+
+		if int64(con.frame.Len()) > max {
+			if _, err := io.Copy(ioutil.Discard, frame); err != nil {
+				return nil, false, err
+			}
+			return nil, false, websocket.ErrFrameTooLarge
+		}
+
+		data := con.frame.Bytes()
+		binary := frame.PayloadType() == websocket.BinaryFrame
+		con.recordLock.Lock()
+		rec := con.recorder
+		con.recordLock.Unlock()
+		if rec != nil {
+			if err := rec.WriteFrame(time.Now(), binary, data); err != nil {
+				return nil, false, err
+			}
+		}
+		return data, binary, nil
+	}
+}
+
+// receiveFrame returns a copy of the next frame, for the proxy.
+func (con *Console) receiveFrame() (rawFrame, error) {
+	data, binary, err := con.ReceiveRaw()
+	if err != nil {
+		return rawFrame{}, err
+	}
 
+	f := rawFrame{data, websocket.TextFrame}
+	if binary {
+		f.ty = websocket.BinaryFrame
+	}
+	return f, nil
+}
+
+func (con *Console) sendFrame(f rawFrame) error {
+	return consoleRawFrameCodec.Send(con.ws, &f)
+}
+
+func (con *Console) ReceiveMessage() (Message, error) {
+	var msg Message
 	for msg.MessageType == "" {
-		if err := consoleMessageCodec.Receive(con.ws, &msg); err != nil {
+		val, data, err := con.receive()
+		if err != nil {
+			return msg, err
+		}
+		if data != nil {
+			continue
+		}
+		if err := unmarshalMessage(val, &msg); err != nil {
 			return msg, err
 		}
 	}
-
 	return msg, nil
 }
 
-func (con *Console) SendCommand(ty CommandType, command string) error {
+// ReceiveFilteredMessage returns the next message accepted by filter.
+func (con *Console) ReceiveFilteredMessage(filter Filter) (Message, error) {
+	for {
+		msg, err := con.ReceiveMessage()
+		if err != nil || filter.Match(msg) {
+			return msg, err
+		}
+	}
+}
+
+func (con *Console) Send(v sjson.Value) error {
 	var buf bytes.Buffer
+	if err := sjson.Encode(&buf, v); err != nil {
+		return err
+	}
+	return consoleMessageCodec.Send(con.ws, buf.Bytes())
+}
 
+func commandMessage(ty CommandType, command string) (sjson.Value, error) {
 	switch ty {
 	case Command:
-		var argsValue []sjson.Value
-
-		args := strings.Split(command, " ")
-		for _, arg := range args[1:] {
-			argsValue = append(argsValue, arg)
+		words, err := SplitCommand(command)
+		if err != nil {
+			return nil, err
+		}
+		if len(words) == 0 {
+			return nil, ErrEmptyCommand
 		}
 
-		m := map[string]sjson.Value{"type": "command", "command": args[0], "arg": argsValue}
-		if err := sjson.Encode(&buf, m); err != nil {
-			return err
+		args := make([]sjson.Value, len(words)-1)
+		for i, arg := range words[1:] {
+			args[i] = arg
 		}
+		return commandArgsMessage(words[0], args), nil
 	case Script:
-		m := map[string]sjson.Value{"type": "script", "script": command}
-		if err := sjson.Encode(&buf, m); err != nil {
-			return err
-		}
+		return map[string]sjson.Value{"type": "script", "script": command}, nil
 	default:
-		return errors.New("invalid command type")
+		return nil, errors.New("invalid command type")
 	}
+}
 
-	return consoleMessageCodec.Send(con.ws, buf.Bytes())
+func (con *Console) SendCommand(ty CommandType, command string) error {
+	msg, err := commandMessage(ty, command)
+	if err != nil {
+		return err
+	}
+	return con.Send(msg)
 }
 
 func (con *Console) SetDeadline(t time.Time) {
@@ -197,6 +314,7 @@ func (con *Console) Host() string {
 }
 
 func (con *Console) Close() {
+	con.StopHeartbeat()
 	con.ws.Close()
 }
 
@@ -210,11 +328,23 @@ func NewConsole(host, protocol string) (*Console, error) {
 	addr := net.JoinHostPort(h, p)
 	url := fmt.Sprintf("ws://%s/%s", addr, protocol)
 
-	ws, err := websocket.Dial(url, "", "http://"+h)
+	config, err := websocket.NewConfig(url, "http://"+h)
 	if err != nil {
 		return nil, err
 	}
 
-	con := &Console{sjson.NewLexer(ws), ws, addr}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, &websocket.DialError{Config: config, Err: err}
+	}
+
+	lc := &liveConn{Conn: conn}
+	ws, err := websocket.NewClient(config, lc)
+	if err != nil {
+		conn.Close()
+		return nil, &websocket.DialError{Config: config, Err: err}
+	}
+
+	con := &Console{ws: ws, conn: lc, host: addr}
 	return con, nil
 }
@@ -18,25 +18,25 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package console
 
 import (
-	"io"
-	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/andreas-jonsson/go-stingray/console/consoletest"
 	"github.com/andreas-jonsson/go-stingray/sjson"
-
-	"golang.org/x/net/websocket"
 )
 
-func consoleServer(ws *websocket.Conn) {
-	io.Copy(ws, ws)
-}
-
-func startServer(t *testing.T) {
-	http.Handle("/", websocket.Handler(consoleServer))
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+func startEngine(t *testing.T) (*consoletest.Engine, *Console) {
+	engine := consoletest.NewEngine()
+	con, err := NewConsole(engine.Addr(), "")
+	if err != nil {
+		engine.Close()
 		t.Fatal(err)
 	}
+	if !engine.WaitForClients(1, time.Second) {
+		t.Fatal("client did not connect")
+	}
+	return engine, con
 }
 
 func receiveAndTest(t *testing.T, con *Console, expected sjson.Value) {
@@ -46,17 +46,15 @@ func receiveAndTest(t *testing.T, con *Console, expected sjson.Value) {
 	}
 
 	if !reflect.DeepEqual(msg, expected) {
-		t.Fail()
+		t.Errorf("expected %v, got %v", expected, msg)
 	}
 }
 
 func TestConsole(t *testing.T) {
-	go startServer(t)
-	con, err := NewConsole("localhost:8080", "")
-	if err != nil {
-		t.Fatal(err)
-	}
+	engine, con := startEngine(t)
+	defer engine.Close()
 	defer con.Close()
+	engine.Echo = true
 
 	if err := con.SendCommand(Command, "test arg1 arg2 arg3"); err != nil {
 		t.Fatal(err)
@@ -73,3 +71,41 @@ func TestConsole(t *testing.T) {
 	cmd = map[string]sjson.Value{"type": "script", "script": "test"}
 	receiveAndTest(t, con, cmd)
 }
+
+func TestReceiveMessage(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+
+	engine.HandleCommand("ping", func(e *consoletest.Engine, args []sjson.Value) {
+		e.Send(map[string]sjson.Value{"type": "unrelated"})
+		e.Log("warning", "Lua", "pong")
+	})
+
+	if err := con.SendCommand(Command, "ping"); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := con.ReceiveMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Time.IsZero() {
+		t.Error("missing receive time")
+	}
+
+	msg.Time = time.Time{}
+	expected := Message{System: "Lua", Level: LevelWarning, MessageType: "log", Message: "pong"}
+	if msg != expected {
+		t.Errorf("expected %v, got %v", expected, msg)
+	}
+
+	engine.Log("info", "Lua", "skipped")
+	engine.Log("error", "Lua", "kept")
+
+	msg, err = con.ReceiveFilteredMessage(MinLevel(LevelError))
+	if err != nil || msg.Message != "kept" {
+		t.Errorf("unexpected message: %v", msg)
+	}
+}
@@ -0,0 +1,292 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package consoletest provides an in-process fake Stingray engine
+// for testing console clients.
+package consoletest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/sjson"
+	"golang.org/x/net/websocket"
+)
+
+type (
+	CommandHandler func(e *Engine, args []sjson.Value)
+	ScriptHandler  func(e *Engine, script string)
+	MessageHandler func(e *Engine, msg map[string]sjson.Value)
+)
+
+// Engine is a fake engine console server listening on a random local port.
+type Engine struct {
+	// Echo sends unhandled client messages back to all clients.
+	Echo bool
+
+	srv *httptest.Server
+
+	lock     sync.Mutex
+	cond     *sync.Cond
+	clients  map[*websocket.Conn]struct{}
+	commands map[string]CommandHandler
+	script   ScriptHandler
+	messages map[string]MessageHandler
+	received []sjson.Value
+}
+
+// Addr returns the host:port of the engine, usable with console.NewConsole.
+func (e *Engine) Addr() string {
+	return strings.TrimPrefix(e.srv.URL, "http://")
+}
+
+func (e *Engine) Close() {
+	e.lock.Lock()
+	for ws := range e.clients {
+		ws.Close()
+	}
+	e.lock.Unlock()
+	e.srv.Close()
+}
+
+func (e *Engine) HandleCommand(name string, h CommandHandler) {
+	e.lock.Lock()
+	e.commands[name] = h
+	e.lock.Unlock()
+}
+
+func (e *Engine) HandleScript(h ScriptHandler) {
+	e.lock.Lock()
+	e.script = h
+	e.lock.Unlock()
+}
+
+// HandleMessage registers a handler for client messages of the given type,
+// other than commands and scripts.
+func (e *Engine) HandleMessage(ty string, h MessageHandler) {
+	e.lock.Lock()
+	e.messages[ty] = h
+	e.lock.Unlock()
+}
+
+// Received returns all messages received from clients so far.
+func (e *Engine) Received() []sjson.Value {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return append([]sjson.Value(nil), e.received...)
+}
+
+// WaitForClients blocks until at least n clients are connected or the timeout expires.
+func (e *Engine) WaitForClients(n int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		e.lock.Lock()
+		num := len(e.clients)
+		e.lock.Unlock()
+
+		if num >= n {
+			return true
+		} else if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// WaitForMessages blocks until at least n messages have been received or the timeout expires.
+func (e *Engine) WaitForMessages(n int, timeout time.Duration) bool {
+	timer := time.AfterFunc(timeout, e.cond.Broadcast)
+	defer timer.Stop()
+
+	deadline := time.Now().Add(timeout)
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for len(e.received) < n {
+		if time.Now().After(deadline) {
+			return false
+		}
+		e.cond.Wait()
+	}
+	return true
+}
+
+func (e *Engine) broadcast(data []byte, ty byte) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	var err error
+	codec := websocket.Codec{Marshal: func(interface{}) ([]byte, byte, error) {
+		return data, ty, nil
+	}}
+
+	for ws := range e.clients {
+		if serr := codec.Send(ws, nil); serr != nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+// Send encodes v as SJSON and sends it to all clients as a text frame.
+func (e *Engine) Send(v sjson.Value) error {
+	var buf bytes.Buffer
+	if err := sjson.Encode(&buf, v); err != nil {
+		return err
+	}
+	return e.broadcast(buf.Bytes(), websocket.TextFrame)
+}
+
+// SendBinary sends a binary frame made of an SJSON header, a zero byte and the payload.
+func (e *Engine) SendBinary(header sjson.Value, payload []byte) error {
+	var buf bytes.Buffer
+	if err := sjson.Encode(&buf, header); err != nil {
+		return err
+	}
+	buf.WriteByte(0)
+	buf.Write(payload)
+	return e.broadcast(buf.Bytes(), websocket.BinaryFrame)
+}
+
+func (e *Engine) Log(level, system, message string) error {
+	return e.Send(map[string]sjson.Value{
+		"type":         "message",
+		"message_type": "log",
+		"level":        level,
+		"system":       system,
+		"message":      message,
+	})
+}
+
+func (e *Engine) SendProfilerStrings(table map[uint64]string) error {
+	m := make(map[string]sjson.Value, len(table))
+	for id, s := range table {
+		m[strconv.FormatUint(id, 10)] = s
+	}
+	return e.Send(map[string]sjson.Value{"type": "profiler_strings", "strings": m})
+}
+
+func (e *Engine) SendProfilerThreads(threads map[uint32]string) error {
+	m := make(map[string]sjson.Value, len(threads))
+	for id, s := range threads {
+		m[strconv.FormatUint(uint64(id), 10)] = s
+	}
+	return e.Send(map[string]sjson.Value{"type": "profiler_threads", "threads": m})
+}
+
+// SendProfilerEvents sends events, typically a slice of console.ProfilerEvent,
+// as a raw big-endian binary frame.
+func (e *Engine) SendProfilerEvents(events interface{}) error {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, events); err != nil {
+		return err
+	}
+	return e.broadcast(buf.Bytes(), websocket.BinaryFrame)
+}
+
+// SendFrameCapture sends one tap of a jittered frame capture in R8G8B8A8 format.
+func (e *Engine) SendFrameCapture(id, tap, numTaps, stride int, pixels []byte) error {
+	header := map[string]sjson.Value{
+		"type":           "frame_capture",
+		"id":             id,
+		"tap":            tap,
+		"num_taps":       numTaps,
+		"stride":         stride,
+		"surface_format": "R8G8B8A8",
+	}
+	return e.SendBinary(header, pixels)
+}
+
+func (e *Engine) dispatch(val sjson.Value) {
+	e.lock.Lock()
+	e.received = append(e.received, val)
+	e.cond.Broadcast()
+
+	var handler func()
+	if m, ok := val.(map[string]sjson.Value); ok {
+		switch m["type"] {
+		case "command":
+			name, _ := m["command"].(string)
+			args, _ := m["arg"].([]sjson.Value)
+			if h, ok := e.commands[name]; ok {
+				handler = func() { h(e, args) }
+			}
+		case "script":
+			script, _ := m["script"].(string)
+			if h := e.script; h != nil {
+				handler = func() { h(e, script) }
+			}
+		default:
+			ty, _ := m["type"].(string)
+			if h, ok := e.messages[ty]; ok {
+				handler = func() { h(e, m) }
+			}
+		}
+	}
+	echo := e.Echo
+	e.lock.Unlock()
+
+	if handler != nil {
+		handler()
+	} else if echo {
+		e.Send(val)
+	}
+}
+
+func (e *Engine) serveClient(ws *websocket.Conn) {
+	e.lock.Lock()
+	e.clients[ws] = struct{}{}
+	e.lock.Unlock()
+
+	defer func() {
+		e.lock.Lock()
+		delete(e.clients, ws)
+		e.lock.Unlock()
+		ws.Close()
+	}()
+
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			return
+		}
+
+		val, err := sjson.Decode(sjson.NewLexer(bytes.NewReader(data)))
+		if err != nil {
+			continue
+		}
+		e.dispatch(val)
+	}
+}
+
+// NewEngine starts a fake engine. Call Close when done.
+func NewEngine() *Engine {
+	e := &Engine{
+		clients:  make(map[*websocket.Conn]struct{}),
+		commands: make(map[string]CommandHandler),
+		messages: make(map[string]MessageHandler),
+	}
+	e.cond = sync.NewCond(&e.lock)
+	e.srv = httptest.NewServer(websocket.Handler(e.serveClient))
+	return e
+}
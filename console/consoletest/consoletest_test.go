@@ -0,0 +1,65 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package consoletest
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/sjson"
+	"golang.org/x/net/websocket"
+)
+
+func TestEngine(t *testing.T) {
+	e := NewEngine()
+	defer e.Close()
+
+	ws, err := websocket.Dial("ws://"+e.Addr()+"/", "", "http://localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	e.HandleCommand("add", func(e *Engine, args []sjson.Value) {
+		e.SendBinary(map[string]sjson.Value{"type": "sum"}, []byte{byte(args[0].(float64) + args[1].(float64))})
+	})
+
+	if err := websocket.Message.Send(ws, `{type="command" command="add" arg=[1, 2]}`); err != nil {
+		t.Fatal(err)
+	}
+
+	var data []byte
+	if err := websocket.Message.Receive(ws, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data[len(data)-2:], []byte{0, 3}) {
+		t.Errorf("unexpected frame: %v", data)
+	}
+
+	if !e.WaitForMessages(1, time.Second) {
+		t.Fatal("no message received")
+	}
+
+	expected := map[string]sjson.Value{"type": "command", "command": "add", "arg": []sjson.Value{1.0, 2.0}}
+	if msg := e.Received()[0]; !reflect.DeepEqual(msg, expected) {
+		t.Errorf("expected %v, got %v", expected, msg)
+	}
+}
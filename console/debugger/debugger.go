@@ -0,0 +1,266 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package debugger implements a client for the Lua debugger protocol
+// carried over the Stingray console connection.
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+const messageType = "lua_debugger"
+
+var ErrNotDebuggerMessage = errors.New("not a debugger message")
+
+type (
+	Variable struct {
+		Name,
+		Type,
+		Value string
+	}
+
+	StackFrame struct {
+		Function,
+		Source string
+		Line int
+
+		Locals,
+		UpValues []Variable
+	}
+
+	// Event is one of Halted, Resumed, Callstack or Table.
+	Event interface{}
+
+	Halted struct {
+		Resource  string
+		Line      int
+		Callstack []StackFrame
+	}
+
+	Resumed struct{}
+
+	Callstack struct {
+		Frames []StackFrame
+	}
+
+	Table struct {
+		Level int
+		Local string
+		Path  []string
+		Items []Variable
+	}
+)
+
+type Debugger struct {
+	con         *console.Console
+	breakpoints map[string]map[int]bool
+}
+
+func (dbg *Debugger) send(command string, args map[string]sjson.Value) error {
+	m := map[string]sjson.Value{"type": messageType, "command": command}
+	for k, v := range args {
+		m[k] = v
+	}
+	return dbg.con.Send(m)
+}
+
+func (dbg *Debugger) sendBreakpoints() error {
+	bp := make(map[string]sjson.Value, len(dbg.breakpoints))
+	for res, lines := range dbg.breakpoints {
+		var sorted []int
+		for line := range lines {
+			sorted = append(sorted, line)
+		}
+		sort.Ints(sorted)
+
+		values := make([]sjson.Value, len(sorted))
+		for i, line := range sorted {
+			values[i] = line
+		}
+		bp[res] = values
+	}
+	return dbg.send("set_breakpoints", map[string]sjson.Value{"breakpoints": bp})
+}
+
+func (dbg *Debugger) SetBreakpoint(resource string, line int) error {
+	lines, ok := dbg.breakpoints[resource]
+	if !ok {
+		lines = make(map[int]bool)
+		dbg.breakpoints[resource] = lines
+	}
+	lines[line] = true
+	return dbg.sendBreakpoints()
+}
+
+func (dbg *Debugger) ClearBreakpoint(resource string, line int) error {
+	if lines, ok := dbg.breakpoints[resource]; ok {
+		delete(lines, line)
+		if len(lines) == 0 {
+			delete(dbg.breakpoints, resource)
+		}
+	}
+	return dbg.sendBreakpoints()
+}
+
+func (dbg *Debugger) ClearBreakpoints() error {
+	dbg.breakpoints = make(map[string]map[int]bool)
+	return dbg.sendBreakpoints()
+}
+
+func (dbg *Debugger) Breakpoints() map[string][]int {
+	bp := make(map[string][]int, len(dbg.breakpoints))
+	for res, lines := range dbg.breakpoints {
+		for line := range lines {
+			bp[res] = append(bp[res], line)
+		}
+		sort.Ints(bp[res])
+	}
+	return bp
+}
+
+func (dbg *Debugger) Break() error {
+	return dbg.send("break", nil)
+}
+
+func (dbg *Debugger) Continue() error {
+	return dbg.send("continue", nil)
+}
+
+func (dbg *Debugger) StepInto() error {
+	return dbg.send("step_into", nil)
+}
+
+func (dbg *Debugger) StepOver() error {
+	return dbg.send("step_over", nil)
+}
+
+func (dbg *Debugger) StepOut() error {
+	return dbg.send("step_out", nil)
+}
+
+func (dbg *Debugger) RequestCallstack() error {
+	return dbg.send("get_callstack", nil)
+}
+
+// ExpandTable requests the content of a table variable. The table is
+// identified by its stack level, the name of the local and the keys
+// leading to the nested table.
+func (dbg *Debugger) ExpandTable(level int, local string, path ...string) error {
+	p := make([]sjson.Value, len(path))
+	for i, k := range path {
+		p[i] = k
+	}
+	return dbg.send("expand_table", map[string]sjson.Value{"level": level, "local": local, "table_path": p})
+}
+
+// Receive blocks until the next debugger event arrives.
+// Frames not belonging to the debugger protocol are discarded.
+func (dbg *Debugger) Receive() (Event, error) {
+	for {
+		val, data, err := dbg.con.Receive()
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > 0 {
+			continue
+		}
+
+		ev, err := ParseEvent(val)
+		if err == ErrNotDebuggerMessage {
+			continue
+		}
+		return ev, err
+	}
+}
+
+func New(con *console.Console) *Debugger {
+	return &Debugger{con: con, breakpoints: make(map[string]map[int]bool)}
+}
+
+// ParseEvent decodes a debugger event from a console message.
+func ParseEvent(v sjson.Value) (ev Event, err error) {
+	m, ok := v.(map[string]sjson.Value)
+	if !ok || m["type"] != messageType {
+		return nil, ErrNotDebuggerMessage
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			ev, err = nil, errors.New("invalid debugger message")
+		}
+	}()
+
+	switch msg := m["message"].(string); msg {
+	case "halted":
+		h := &Halted{Resource: m["resource"].(string), Line: int(m["line"].(float64))}
+		if cs, ok := m["callstack"]; ok {
+			h.Callstack = parseCallstack(cs)
+		}
+		return h, nil
+	case "resumed":
+		return &Resumed{}, nil
+	case "callstack":
+		return &Callstack{parseCallstack(m["callstack"])}, nil
+	case "expand_table_result":
+		t := &Table{Level: int(m["level"].(float64)), Local: m["local"].(string)}
+		for _, k := range m["table_path"].([]sjson.Value) {
+			t.Path = append(t.Path, k.(string))
+		}
+		t.Items = parseVariables(m["table"])
+		return t, nil
+	default:
+		return nil, fmt.Errorf("unknown debugger message: %s", msg)
+	}
+}
+
+func parseCallstack(v sjson.Value) []StackFrame {
+	var frames []StackFrame
+	for _, f := range v.([]sjson.Value) {
+		m := f.(map[string]sjson.Value)
+		frames = append(frames, StackFrame{
+			Function: m["function_name"].(string),
+			Source:   m["source"].(string),
+			Line:     int(m["line"].(float64)),
+			Locals:   parseVariables(m["local"]),
+			UpValues: parseVariables(m["up_values"]),
+		})
+	}
+	return frames
+}
+
+func parseVariables(v sjson.Value) []Variable {
+	if v == nil {
+		return nil
+	}
+
+	var vars []Variable
+	for _, e := range v.([]sjson.Value) {
+		m := e.(map[string]sjson.Value)
+		vars = append(vars, Variable{
+			Name:  m["var_name"].(string),
+			Type:  m["type"].(string),
+			Value: fmt.Sprint(m["value"]),
+		})
+	}
+	return vars
+}
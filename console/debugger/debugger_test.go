@@ -0,0 +1,109 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package debugger
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/consoletest"
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+const haltedMessage = `{
+	type = "lua_debugger"
+	message = "halted"
+	resource = "script/lua/boot"
+	line = 12
+	callstack = [{
+		function_name = "update"
+		source = "@script/lua/boot.lua"
+		line = 12
+		local = [{var_name = "dt", type = "number", value = 0.016}]
+		up_values = []
+	}]
+}`
+
+func TestDebugger(t *testing.T) {
+	halted, err := sjson.Decode(sjson.NewLexer(strings.NewReader(haltedMessage)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := consoletest.NewEngine()
+	defer engine.Close()
+
+	engine.HandleMessage("lua_debugger", func(e *consoletest.Engine, m map[string]sjson.Value) {
+		if m["command"] == "set_breakpoints" {
+			e.Log("info", "Lua", "ignored")
+			e.Send(halted)
+		}
+	})
+
+	con, err := console.NewConsole(engine.Addr(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Close()
+
+	dbg := New(con)
+	if err := dbg.SetBreakpoint("script/lua/boot", 12); err != nil {
+		t.Fatal(err)
+	}
+
+	ev, err := dbg.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Halted{
+		Resource: "script/lua/boot",
+		Line:     12,
+		Callstack: []StackFrame{{
+			Function: "update",
+			Source:   "@script/lua/boot.lua",
+			Line:     12,
+			Locals:   []Variable{{"dt", "number", "0.016"}},
+		}},
+	}
+
+	if !reflect.DeepEqual(ev, expected) {
+		t.Errorf("unexpected event: %+v", ev)
+	}
+
+	if bp := dbg.Breakpoints(); !reflect.DeepEqual(bp, map[string][]int{"script/lua/boot": {12}}) {
+		t.Errorf("unexpected breakpoints: %v", bp)
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	if _, err := ParseEvent(map[string]sjson.Value{"type": "message"}); err != ErrNotDebuggerMessage {
+		t.Fail()
+	}
+
+	if _, err := ParseEvent(map[string]sjson.Value{"type": "lua_debugger", "message": "halted"}); err == nil {
+		t.Fail()
+	}
+
+	ev, err := ParseEvent(map[string]sjson.Value{"type": "lua_debugger", "message": "resumed"})
+	if _, ok := ev.(*Resumed); !ok || err != nil {
+		t.Fail()
+	}
+}
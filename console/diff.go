@@ -0,0 +1,182 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+const pathSeparator = "\x00"
+
+// PathTotals is the time and number of calls of a scope path, in seconds
+// and calls per frame.
+type PathTotals struct {
+	Inclusive,
+	Exclusive,
+	Calls float64
+}
+
+func (t PathTotals) sub(o PathTotals) PathTotals {
+	return PathTotals{t.Inclusive - o.Inclusive, t.Exclusive - o.Exclusive, t.Calls - o.Calls}
+}
+
+type pathSamples struct {
+	path []string
+	PathTotals
+}
+
+// PathCollector aggregates scopes by name path over frames. The first
+// element of each path is the thread name.
+type PathCollector struct {
+	paths  map[string]*pathSamples
+	frames int
+}
+
+func (c *PathCollector) Frames() int {
+	return c.frames
+}
+
+func (c *PathCollector) AddFrame(frame *ProfilerFrame) {
+	c.frames++
+
+	var visit func(s *Scope, path []string)
+	visit = func(s *Scope, path []string) {
+		path = append(path, s.Scope)
+		key := strings.Join(path, pathSeparator)
+
+		samples, ok := c.paths[key]
+		if !ok {
+			samples = &pathSamples{path: append([]string(nil), path...)}
+			c.paths[key] = samples
+		}
+		samples.Inclusive += s.Inclusive
+		samples.Exclusive += s.Exclusive
+		samples.Calls++
+
+		for _, child := range s.Children {
+			visit(child, path)
+		}
+	}
+
+	for _, t := range frame.Threads {
+		for _, root := range t.Roots {
+			visit(root, []string{t.Thread})
+		}
+	}
+}
+
+// Totals returns the per frame averages of a path, and false if the path
+// was never seen.
+func (c *PathCollector) Totals(path ...string) (PathTotals, bool) {
+	samples, ok := c.paths[strings.Join(path, pathSeparator)]
+	if !ok {
+		return PathTotals{}, false
+	}
+	return c.average(samples), true
+}
+
+func (c *PathCollector) average(samples *pathSamples) PathTotals {
+	n := float64(c.frames)
+	return PathTotals{samples.Inclusive / n, samples.Exclusive / n, samples.Calls / n}
+}
+
+func NewPathCollector() *PathCollector {
+	return &PathCollector{paths: make(map[string]*pathSamples)}
+}
+
+// ScopeDelta is the change of one scope path between two collections.
+// Base or Current is zero if the path is missing from that collection.
+type ScopeDelta struct {
+	Path []string
+
+	Base,
+	Current,
+	Delta PathTotals
+
+	// Relative is Delta divided by Base, or +Inf for added paths.
+	Relative PathTotals
+}
+
+func (d *ScopeDelta) Added() bool {
+	return d.Base.Calls == 0
+}
+
+func (d *ScopeDelta) Removed() bool {
+	return d.Current.Calls == 0
+}
+
+func relative(delta, base float64) float64 {
+	switch {
+	case base != 0:
+		return delta / base
+	case delta > 0:
+		return math.Inf(1)
+	case delta < 0:
+		return math.Inf(-1)
+	}
+	return 0
+}
+
+// DiffPaths compares every path seen in either collection. Times are per
+// frame averages, so collections with different numbers of frames can be
+// compared. The result is sorted by the absolute change in inclusive time,
+// largest first.
+func DiffPaths(base, current *PathCollector) []ScopeDelta {
+	deltas := make(map[string]*ScopeDelta)
+	get := func(key string, path []string) *ScopeDelta {
+		d, ok := deltas[key]
+		if !ok {
+			d = &ScopeDelta{Path: path}
+			deltas[key] = d
+		}
+		return d
+	}
+
+	if base.frames > 0 {
+		for key, samples := range base.paths {
+			get(key, samples.path).Base = base.average(samples)
+		}
+	}
+	if current.frames > 0 {
+		for key, samples := range current.paths {
+			get(key, samples.path).Current = current.average(samples)
+		}
+	}
+
+	result := make([]ScopeDelta, 0, len(deltas))
+	for _, d := range deltas {
+		d.Delta = d.Current.sub(d.Base)
+		d.Relative = PathTotals{
+			relative(d.Delta.Inclusive, d.Base.Inclusive),
+			relative(d.Delta.Exclusive, d.Base.Exclusive),
+			relative(d.Delta.Calls, d.Base.Calls),
+		}
+		result = append(result, *d)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := math.Abs(result[i].Delta.Inclusive), math.Abs(result[j].Delta.Inclusive)
+		if a != b {
+			return a > b
+		}
+		return strings.Join(result[i].Path, pathSeparator) < strings.Join(result[j].Path, pathSeparator)
+	})
+	return result
+}
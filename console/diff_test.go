@@ -0,0 +1,91 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/consoletest/profiletest"
+)
+
+func TestDiffPaths(t *testing.T) {
+	base := console.NewPathCollector()
+	for i := 0; i < 2; i++ {
+		base.AddFrame(console.BuildFrame([]console.ResolvedEvent{
+			profiletest.Event("frame", "main", 1, -1, 0, 0.010),
+			profiletest.Event("update", "main", 1, 0, 0, 0.004),
+			profiletest.Event("gc", "main", 1, 0, 0.004, 0.001),
+		}))
+	}
+
+	current := console.NewPathCollector()
+	for i := 0; i < 4; i++ {
+		current.AddFrame(console.BuildFrame([]console.ResolvedEvent{
+			profiletest.Event("frame", "main", 1, -1, 0, 0.014),
+			profiletest.Event("update", "main", 1, 0, 0, 0.003),
+			profiletest.Event("update", "main", 1, 0, 0.003, 0.003),
+			profiletest.Event("render", "main", 1, 0, 0.006, 0.002),
+		}))
+	}
+
+	if totals, ok := current.Totals("main", "frame", "update"); !ok || !profiletest.AlmostEqual(totals.Inclusive, 0.006) || totals.Calls != 2 {
+		t.Errorf("unexpected totals: %+v", totals)
+	}
+	if _, ok := current.Totals("main", "gc"); ok {
+		t.Error("unexpected path")
+	}
+
+	deltas := console.DiffPaths(base, current)
+
+	var paths [][]string
+	for _, d := range deltas {
+		paths = append(paths, d.Path)
+	}
+	expected := [][]string{
+		{"main", "frame"},
+		{"main", "frame", "render"},
+		{"main", "frame", "update"},
+		{"main", "frame", "gc"},
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("unexpected order: %v", paths)
+	}
+
+	frame := deltas[0]
+	if !profiletest.AlmostEqual(frame.Delta.Inclusive, 0.004) || !profiletest.AlmostEqual(frame.Relative.Inclusive, 0.4) || !profiletest.AlmostEqual(frame.Delta.Exclusive, 0.001) {
+		t.Errorf("unexpected frame delta: %+v", frame)
+	}
+
+	render := deltas[1]
+	if !render.Added() || render.Removed() || !math.IsInf(render.Relative.Inclusive, 1) {
+		t.Errorf("unexpected render delta: %+v", render)
+	}
+
+	update := deltas[2]
+	if update.Delta.Calls != 1 || update.Relative.Calls != 1 || !profiletest.AlmostEqual(update.Delta.Inclusive, 0.002) {
+		t.Errorf("unexpected update delta: %+v", update)
+	}
+
+	gc := deltas[3]
+	if !gc.Removed() || gc.Relative.Inclusive != -1 {
+		t.Errorf("unexpected gc delta: %+v", gc)
+	}
+}
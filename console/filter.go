@@ -0,0 +1,117 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Level int
+
+const (
+	LevelInfo Level = iota
+	LevelWarning
+	LevelError
+)
+
+var levelNames = [...]string{"info", "warning", "error"}
+
+var ErrUnknownLevel = errors.New("unknown level")
+
+func (l Level) String() string {
+	if l >= 0 && int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel converts a level name to a Level. Unknown names return
+// LevelInfo and ErrUnknownLevel.
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, ErrUnknownLevel
+}
+
+// Filter reports whether a message should be kept. A nil filter keeps everything.
+type Filter func(msg Message) bool
+
+func (f Filter) Match(msg Message) bool {
+	return f == nil || f(msg)
+}
+
+func MinLevel(level Level) Filter {
+	return func(msg Message) bool {
+		return msg.Level >= level
+	}
+}
+
+func IncludeSystems(systems ...string) Filter {
+	return func(msg Message) bool {
+		for _, s := range systems {
+			if strings.EqualFold(msg.System, s) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func ExcludeSystems(systems ...string) Filter {
+	return Not(IncludeSystems(systems...))
+}
+
+func MatchText(re *regexp.Regexp) Filter {
+	return func(msg Message) bool {
+		return re.MatchString(msg.Message)
+	}
+}
+
+func And(filters ...Filter) Filter {
+	return func(msg Message) bool {
+		for _, f := range filters {
+			if !f.Match(msg) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func Or(filters ...Filter) Filter {
+	return func(msg Message) bool {
+		for _, f := range filters {
+			if f.Match(msg) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func Not(f Filter) Filter {
+	return func(msg Message) bool {
+		return !f.Match(msg)
+	}
+}
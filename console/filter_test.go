@@ -0,0 +1,71 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestLevel(t *testing.T) {
+	for s, expected := range map[string]Level{"Warning": LevelWarning, "error": LevelError, "info": LevelInfo} {
+		if level, err := ParseLevel(s); err != nil || level != expected {
+			t.Errorf("%s: unexpected level: %v, %v", s, level, err)
+		}
+	}
+	for _, s := range []string{"warn", "debug", ""} {
+		if level, err := ParseLevel(s); err != ErrUnknownLevel || level != LevelInfo {
+			t.Errorf("%s: expected unknown level, got: %v, %v", s, level, err)
+		}
+	}
+	if !(LevelInfo < LevelWarning && LevelWarning < LevelError) {
+		t.Fail()
+	}
+	if LevelError.String() != "error" {
+		t.Fail()
+	}
+}
+
+func TestFilter(t *testing.T) {
+	msgs := []Message{
+		{System: "Lua", Level: LevelInfo, Message: "fps: 60"},
+		{System: "Lua", Level: LevelError, Message: "nil value"},
+		{System: "Render", Level: LevelWarning, Message: "fps: 20"},
+	}
+
+	tests := []struct {
+		filter   Filter
+		expected []bool
+	}{
+		{nil, []bool{true, true, true}},
+		{MinLevel(LevelWarning), []bool{false, true, true}},
+		{IncludeSystems("lua"), []bool{true, true, false}},
+		{ExcludeSystems("Lua"), []bool{false, false, true}},
+		{MatchText(regexp.MustCompile(`fps: \d+`)), []bool{true, false, true}},
+		{And(IncludeSystems("Lua"), MinLevel(LevelError)), []bool{false, true, false}},
+		{Or(IncludeSystems("Render"), MinLevel(LevelError)), []bool{false, true, true}},
+	}
+
+	for i, test := range tests {
+		for j, msg := range msgs {
+			if test.filter.Match(msg) != test.expected[j] {
+				t.Errorf("filter %d, message %d: expected %v", i, j, test.expected[j])
+			}
+		}
+	}
+}
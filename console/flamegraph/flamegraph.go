@@ -0,0 +1,201 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package flamegraph renders profiler scope trees as self contained,
+// interactive flame graph and icicle SVGs.
+package flamegraph
+
+import (
+	"math"
+	"sort"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+)
+
+// Node is a scope path aggregated over all frames of a graph.
+// Times are in seconds.
+type Node struct {
+	Name string
+
+	// Value is the total inclusive time of the path, and Self the part of it
+	// not spent in child scopes.
+	Value,
+	Self float64
+	Calls int
+
+	// Delta and SelfDelta are the change per frame in Value and Self from
+	// the baseline of a differential graph.
+	Delta,
+	SelfDelta float64
+
+	Children []*Node
+	index    map[string]*Node
+
+	// width is the drawn size of a differential node, which also covers
+	// its time in the baseline.
+	width float64
+}
+
+// Child returns the child with the given name, creating it if needed.
+func (n *Node) Child(name string) *Node {
+	if c, ok := n.index[name]; ok {
+		return c
+	}
+	if n.index == nil {
+		n.index = make(map[string]*Node)
+	}
+
+	c := &Node{Name: name}
+	n.index[name] = c
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// Lookup returns the node at path below n, or nil.
+func (n *Node) Lookup(path ...string) *Node {
+	for _, name := range path {
+		if n = n.index[name]; n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+func (n *Node) sort() {
+	sort.Slice(n.Children, func(i, j int) bool {
+		return n.Children[i].Name < n.Children[j].Name
+	})
+	for _, c := range n.Children {
+		c.sort()
+	}
+}
+
+// Graph merges the scope trees of any number of frames. The root has one
+// child per thread, with the scopes of that thread below it.
+type Graph struct {
+	Root   *Node
+	Frames int
+
+	differential bool
+}
+
+func (g *Graph) add(parent *Node, s *console.Scope) {
+	n := parent.Child(s.Scope)
+	n.Value += s.Inclusive
+	n.Self += s.Exclusive
+	n.Calls++
+
+	for _, c := range s.Children {
+		g.add(n, c)
+	}
+}
+
+func (g *Graph) AddFrame(frame *console.ProfilerFrame) {
+	g.Frames++
+	for _, t := range frame.Threads {
+		thread := g.Root.Child(t.Thread)
+		for _, root := range t.Roots {
+			thread.Value += root.Inclusive
+			g.add(thread, root)
+		}
+	}
+
+	g.Root.Value = 0
+	for _, t := range g.Root.Children {
+		g.Root.Value += t.Value
+	}
+}
+
+// PerFrame returns v averaged over the frames of the graph.
+func (g *Graph) PerFrame(v float64) float64 {
+	if g.Frames == 0 {
+		return 0
+	}
+	return v / float64(g.Frames)
+}
+
+// size returns the drawn size of n.
+func (g *Graph) size(n *Node) float64 {
+	if g.differential {
+		return n.width
+	}
+	return n.Value
+}
+
+// fit makes every differential node at least as wide as its children.
+func (n *Node) fit() float64 {
+	var children float64
+	for _, c := range n.Children {
+		children += c.fit()
+	}
+	n.width = math.Max(n.width, children)
+	return n.width
+}
+
+// FromDeltas returns a differential graph of the per frame changes from
+// console.DiffPaths. Scopes are coloured by the change in self time, red for
+// slower and blue for faster, and drawn as wide as their time in the base or
+// the current collection, whichever is larger, so removed scopes are shown.
+func FromDeltas(deltas []console.ScopeDelta) *Graph {
+	g := New()
+	g.Frames = 1
+	g.differential = true
+
+	for i := range deltas {
+		d := &deltas[i]
+		if len(d.Path) < 2 {
+			continue
+		}
+
+		thread := g.Root.Child(d.Path[0])
+		n := thread
+		for _, name := range d.Path[1:] {
+			n = n.Child(name)
+		}
+
+		n.Value = d.Current.Inclusive
+		n.Self = d.Current.Exclusive
+		n.Calls = int(math.Round(d.Current.Calls))
+		n.Delta = d.Delta.Inclusive
+		n.SelfDelta = d.Delta.Exclusive
+		n.width = math.Max(d.Base.Inclusive, d.Current.Inclusive)
+
+		// Thread totals are the sum of their roots.
+		if len(d.Path) == 2 {
+			thread.Value += n.Value
+			thread.Delta += n.Delta
+			g.Root.Value += n.Value
+			g.Root.Delta += n.Delta
+		}
+	}
+
+	g.Root.fit()
+	return g
+}
+
+func New() *Graph {
+	return &Graph{Root: &Node{Name: "all"}}
+}
+
+// FromFrames returns a graph of all frames.
+func FromFrames(frames []*console.ProfilerFrame) *Graph {
+	g := New()
+	for _, f := range frames {
+		g.AddFrame(f)
+	}
+	return g
+}
@@ -0,0 +1,192 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package flamegraph
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/consoletest/profiletest"
+)
+
+func TestGraph(t *testing.T) {
+	g := FromFrames([]*console.ProfilerFrame{profiletest.Frame(), profiletest.Frame()})
+
+	if g.Frames != 2 || !profiletest.AlmostEqual(g.Root.Value, 0.026) {
+		t.Errorf("unexpected root: %d frames, %f", g.Frames, g.Root.Value)
+	}
+
+	frame := g.Root.Lookup("main", "frame")
+	if frame == nil || frame.Calls != 2 || !profiletest.AlmostEqual(frame.Value, 0.02) || !profiletest.AlmostEqual(frame.Self, 0.008) {
+		t.Fatalf("unexpected frame node: %+v", frame)
+	}
+	if n := g.Root.Lookup("main", "frame", "update"); n == nil || !profiletest.AlmostEqual(g.PerFrame(n.Value), 0.004) {
+		t.Errorf("unexpected update node: %+v", n)
+	}
+	if g.Root.Lookup("main", "update") != nil {
+		t.Error("unexpected node")
+	}
+}
+
+// rectY returns the y position of the scope with the given name.
+func rectY(t *testing.T, svg []byte, name string) string {
+	dec := xml.NewDecoder(bytes.NewReader(svg))
+	var inside bool
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		if e, ok := tok.(xml.StartElement); ok {
+			for _, a := range e.Attr {
+				if e.Name.Local == "g" && a.Name.Local == "data-n" {
+					inside = a.Value == name
+				}
+				if inside && e.Name.Local == "rect" && a.Name.Local == "y" {
+					return a.Value
+				}
+			}
+		}
+	}
+	t.Fatalf("scope not found: %s", name)
+	return ""
+}
+
+func TestWriteSVG(t *testing.T) {
+	g := FromFrames([]*console.ProfilerFrame{profiletest.Frame()})
+
+	var flame, icicle bytes.Buffer
+	if err := g.WriteSVG(&flame, Options{Title: "test & title"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.WriteSVG(&icicle, Options{Icicle: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"test &amp; title", "render &lt;scene&gt; (2.000 ms/frame", "function zoom("} {
+		if !strings.Contains(flame.String(), s) {
+			t.Errorf("missing %q", s)
+		}
+	}
+
+	// The root is at the bottom of a flame graph and at the top of an icicle graph.
+	if y := rectY(t, flame.Bytes(), "all"); y != "88" {
+		t.Errorf("unexpected flame graph root position: %s", y)
+	}
+	if y := rectY(t, icicle.Bytes(), "all"); y != "40" {
+		t.Errorf("unexpected icicle graph root position: %s", y)
+	}
+	if y := rectY(t, icicle.Bytes(), "update"); y != "88" {
+		t.Errorf("unexpected icicle graph scope position: %s", y)
+	}
+}
+
+func TestLabel(t *testing.T) {
+	// Room for five characters.
+	width := 6 + 5*fontSize*fontWidth
+	tests := map[string]string{
+		"frame":   "frame",
+		"update":  "upd..",
+		"ÅÄÖåäö":  "ÅÄÖ..",
+		"日本語テキスト": "日本語..",
+	}
+	for name, expected := range tests {
+		if l := label(name, width); l != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, l)
+		}
+	}
+	if l := label("update", 6+2*fontSize*fontWidth); l != "" {
+		t.Errorf("unexpected label: %q", l)
+	}
+}
+
+func TestWriteSVGEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := New().WriteSVG(&buf, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal(buf.Bytes(), new(struct{})); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDifferential(t *testing.T) {
+	base := console.NewPathCollector()
+	base.AddFrame(profiletest.Frame())
+
+	events := []console.ResolvedEvent{
+		profiletest.Event("frame", "main", 0, -1, 0, 0.01),
+		profiletest.Event("update", "main", 0, 0, 0.001, 0.002),
+		profiletest.Event("audio", "main", 0, 0, 0.003, 0.001),
+	}
+
+	// Two frames, so values are compared per frame.
+	current := console.NewPathCollector()
+	current.AddFrame(console.BuildFrame(events))
+	current.AddFrame(console.BuildFrame(events))
+
+	g := FromDeltas(console.DiffPaths(base, current))
+
+	update := g.Root.Lookup("main", "frame", "update")
+	if !profiletest.AlmostEqual(update.Delta, -0.002) || !profiletest.AlmostEqual(update.SelfDelta, -0.002) {
+		t.Errorf("unexpected update delta: %+v", update)
+	}
+	if audio := g.Root.Lookup("main", "frame", "audio"); !profiletest.AlmostEqual(audio.Delta, 0.001) || audio.Calls != 1 {
+		t.Errorf("unexpected audio delta: %+v", audio)
+	}
+	if frame := g.Root.Lookup("main", "frame"); !profiletest.AlmostEqual(frame.Delta, 0) || !profiletest.AlmostEqual(frame.SelfDelta, 0.003) {
+		t.Errorf("unexpected frame delta: %+v", frame)
+	}
+	if !profiletest.AlmostEqual(g.Root.Value, 0.01) || !profiletest.AlmostEqual(g.Root.Delta, -0.003) || !profiletest.AlmostEqual(g.Root.width, 0.013) {
+		t.Errorf("unexpected root: %+v", g.Root)
+	}
+
+	// Removed scopes keep their baseline width.
+	render := g.Root.Lookup("main", "frame", "render <scene>")
+	if render == nil || render.Value != 0 || !profiletest.AlmostEqual(render.Delta, -0.002) || !profiletest.AlmostEqual(render.width, 0.002) {
+		t.Errorf("unexpected render delta: %+v", render)
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteSVG(&buf, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"Differential Flame Graph",
+		"audio (1.000 ms/frame, 10.00%, self 1.000 ms/frame, 1 calls, +1.000 ms/frame (new)",
+		"update (2.000 ms/frame",
+		"render &lt;scene&gt; (0.000 ms/frame, 0.00%, -2.000 ms/frame (-100.0%)",
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("missing %q", s)
+		}
+	}
+	if rectY(t, buf.Bytes(), "job") != rectY(t, buf.Bytes(), "frame") {
+		t.Error("removed thread not drawn")
+	}
+	if !strings.Contains(buf.String(), `fill="rgb(255,0,0)"`) || !strings.Contains(buf.String(), `fill="rgb(0,0,255)"`) {
+		t.Error("missing fully saturated scope")
+	}
+}
@@ -0,0 +1,302 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package flamegraph
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"math"
+)
+
+const (
+	DefaultWidth       = 1200
+	DefaultFrameHeight = 16
+
+	padding      = 10
+	titleHeight  = 40
+	detailHeight = 30
+	fontSize     = 12
+	fontWidth    = 0.59
+)
+
+type Options struct {
+	// Title defaults to "Flame Graph" or "Icicle Graph", prefixed with
+	// "Differential" for differential graphs.
+	Title string
+
+	// Icicle draws the roots at the top, growing downwards.
+	Icicle bool
+
+	// Width of the image in pixels, and height of each scope.
+	Width,
+	FrameHeight int
+
+	// MinWidth omits scopes narrower than this many pixels. Defaults to 0.1.
+	MinWidth float64
+}
+
+type box struct {
+	node  *Node
+	depth int
+	x, w  float64
+}
+
+// label truncates name to fit in width pixels, or returns an empty string.
+func label(name string, width float64) string {
+	chars := int((width - 6) / (fontSize * fontWidth))
+	if chars < 3 {
+		return ""
+	}
+	runes := []rune(name)
+	if len(runes) <= chars {
+		return name
+	}
+	return string(runes[:chars-2]) + ".."
+}
+
+// color returns a warm color, stable for the same name.
+func color(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	v := h.Sum32()
+
+	r := 205 + v%50
+	g := (v >> 8) % 230
+	b := (v >> 16) % 55
+	return fmt.Sprintf("rgb(%d,%d,%d)", r, g, b)
+}
+
+// diffColor returns red for positive and blue for negative deltas, more
+// saturated the closer delta is to max.
+func diffColor(delta, max float64) string {
+	if max == 0 || delta == 0 {
+		return "rgb(230,230,230)"
+	}
+
+	c := int(230 * (1 - math.Min(math.Abs(delta)/max, 1)))
+	if delta > 0 {
+		return fmt.Sprintf("rgb(255,%d,%d)", c, c)
+	}
+	return fmt.Sprintf("rgb(%d,%d,255)", c, c)
+}
+
+func ms(seconds float64) float64 {
+	return seconds * 1000
+}
+
+func (g *Graph) layout(opt *Options) (boxes []box, maxDepth int) {
+	scale := float64(opt.Width-2*padding) / g.size(g.Root)
+
+	var visit func(n *Node, depth int, x float64)
+	visit = func(n *Node, depth int, x float64) {
+		w := g.size(n) * scale
+		if w < opt.MinWidth {
+			return
+		}
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		boxes = append(boxes, box{n, depth, x, w})
+
+		for _, c := range n.Children {
+			visit(c, depth+1, x)
+			x += g.size(c) * scale
+		}
+	}
+
+	g.Root.sort()
+	visit(g.Root, 0, 0)
+	return
+}
+
+func (g *Graph) tooltip(n *Node) string {
+	percent := 100.0
+	if g.Root.Value > 0 {
+		percent = n.Value / g.Root.Value * 100
+	}
+
+	s := fmt.Sprintf("%s (%.3f ms/frame, %.2f%%", n.Name, ms(g.PerFrame(n.Value)), percent)
+	if n.Calls > 0 {
+		s += fmt.Sprintf(", self %.3f ms/frame, %d calls", ms(g.PerFrame(n.Self)), n.Calls)
+	}
+	if g.differential {
+		s += fmt.Sprintf(", %+.3f ms/frame", ms(n.Delta))
+		if base := g.PerFrame(n.Value) - n.Delta; base > 0 {
+			s += fmt.Sprintf(" (%+.1f%%)", n.Delta/base*100)
+		} else {
+			s += " (new)"
+		}
+		s += fmt.Sprintf(", self %+.3f ms/frame", ms(n.SelfDelta))
+	}
+	return s + ")"
+}
+
+// WriteSVG renders the graph. Clicking a scope zooms in on it, and hovering
+// shows its times averaged over the frames of the graph.
+func (g *Graph) WriteSVG(writer io.Writer, opt Options) error {
+	if opt.Width <= 2*padding {
+		opt.Width = DefaultWidth
+	}
+	if opt.FrameHeight <= 0 {
+		opt.FrameHeight = DefaultFrameHeight
+	}
+	if opt.MinWidth <= 0 {
+		opt.MinWidth = 0.1
+	}
+	if opt.Title == "" {
+		opt.Title = "Flame Graph"
+		if opt.Icicle {
+			opt.Title = "Icicle Graph"
+		}
+		if g.differential {
+			opt.Title = "Differential " + opt.Title
+		}
+	}
+
+	var boxes []box
+	maxDepth := 0
+	if g.size(g.Root) > 0 {
+		boxes, maxDepth = g.layout(&opt)
+	}
+
+	var maxDelta float64
+	for _, b := range boxes {
+		maxDelta = math.Max(maxDelta, math.Abs(b.node.SelfDelta))
+	}
+
+	fh := opt.FrameHeight
+	height := titleHeight + (maxDepth+1)*fh + detailHeight
+
+	w := bufio.NewWriter(writer)
+	fmt.Fprintf(w, svgHeader, opt.Width, height, opt.Width, height, padding, opt.Width-2*padding, fh)
+	fmt.Fprintf(w, `<rect x="0" y="0" width="%d" height="%d" fill="#f8f8f8"/>`+"\n", opt.Width, height)
+	fmt.Fprintf(w, `<text class="title" x="%d" y="24">%s</text>`+"\n", opt.Width/2, html.EscapeString(opt.Title))
+	fmt.Fprintf(w, `<text id="unzoom" class="hidden" x="%d" y="24">Reset Zoom</text>`+"\n", padding)
+	fmt.Fprintf(w, `<text id="details" x="%d" y="%d"> </text>`+"\n", padding, height-10)
+
+	for _, b := range boxes {
+		y := titleHeight + (maxDepth-b.depth)*fh
+		if opt.Icicle {
+			y = titleHeight + b.depth*fh
+		}
+
+		fill := color(b.node.Name)
+		if g.differential {
+			fill = diffColor(b.node.SelfDelta, maxDelta)
+		}
+
+		name := html.EscapeString(b.node.Name)
+		fmt.Fprintf(w, `<g class="f" data-x="%.3f" data-w="%.3f" data-d="%d" data-n="%s">`, b.x, b.w, b.depth, name)
+		fmt.Fprintf(w, `<title>%s</title>`, html.EscapeString(g.tooltip(b.node)))
+		fmt.Fprintf(w, `<rect x="%.3f" y="%d" width="%.3f" height="%d" fill="%s" rx="2"/>`,
+			b.x+padding, y, b.w, fh-1, fill)
+		fmt.Fprintf(w, `<text x="%.3f" y="%d">%s</text></g>`+"\n",
+			b.x+padding+3, y+fh-4, html.EscapeString(label(b.node.Name, b.w)))
+	}
+
+	w.WriteString("</svg>\n")
+	return w.Flush()
+}
+
+// svgHeader is formatted with the image size twice, then the padding, the
+// drawable width and the frame height used by the zoom script.
+const svgHeader = `<?xml version="1.0" standalone="no"?>
+<svg version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg" onload="init(evt)">
+<style type="text/css">
+	text { font-family: Verdana, sans-serif; font-size: 12px; fill: #000; }
+	.title { font-size: 17px; text-anchor: middle; }
+	.f { cursor: pointer; }
+	.f:hover rect { stroke: #000; stroke-width: 0.5; }
+	.hidden { display: none; }
+	#unzoom { cursor: pointer; }
+</style>
+<script type="text/ecmascript"><![CDATA[
+	var padding = %d, width = %d, frameHeight = %d, details, unzoom;
+
+	function init(evt) {
+		details = document.getElementById("details").firstChild;
+		unzoom = document.getElementById("unzoom");
+		unzoom.addEventListener("click", function() { zoom(null); });
+
+		var frames = document.getElementsByClassName("f");
+		for (var i = 0; i < frames.length; i++) {
+			var f = frames[i];
+			f.addEventListener("click", function(e) { zoom(this); });
+			f.addEventListener("mouseover", function(e) {
+				details.nodeValue = this.getElementsByTagName("title")[0].textContent;
+			});
+			f.addEventListener("mouseout", function(e) { details.nodeValue = " "; });
+		}
+	}
+
+	function attr(e, name) {
+		return parseFloat(e.getAttribute(name));
+	}
+
+	function label(name, w) {
+		var chars = Math.floor((w - 6) / (12 * 0.59));
+		if (chars < 3) return "";
+		if (name.length <= chars) return name;
+		return name.substring(0, chars - 2) + "..";
+	}
+
+	function place(f, x, w) {
+		var rect = f.getElementsByTagName("rect")[0];
+		var text = f.getElementsByTagName("text")[0];
+		rect.setAttribute("x", x + padding);
+		rect.setAttribute("width", w);
+		text.setAttribute("x", x + padding + 3);
+		text.textContent = label(f.getAttribute("data-n"), w);
+		f.classList.remove("hidden");
+	}
+
+	function zoom(target) {
+		var zx = 0, zw = width, zd = 0;
+		if (target) {
+			zx = attr(target, "data-x");
+			zw = attr(target, "data-w");
+			zd = attr(target, "data-d");
+			unzoom.classList.remove("hidden");
+		} else {
+			unzoom.classList.add("hidden");
+		}
+
+		var scale = width / zw, eps = 0.0001;
+		var frames = document.getElementsByClassName("f");
+		for (var i = 0; i < frames.length; i++) {
+			var f = frames[i];
+			var x = attr(f, "data-x"), w = attr(f, "data-w"), d = attr(f, "data-d");
+
+			if (d < zd) {
+				if (x <= zx + eps && x + w >= zx + zw - eps) {
+					place(f, 0, width);
+				} else {
+					f.classList.add("hidden");
+				}
+			} else if (x >= zx - eps && x + w <= zx + zw + eps) {
+				place(f, (x - zx) * scale, w * scale);
+			} else {
+				f.classList.add("hidden");
+			}
+		}
+	}
+]]></script>
+`
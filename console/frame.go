@@ -0,0 +1,68 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"sync"
+
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+// frameDecoder decodes SJSON directly from frame data, reusing the same
+// lexer for every frame.
+type frameDecoder struct {
+	lock sync.Mutex
+	lex  *sjson.Lexer
+}
+
+// decode returns the first value in data and the number of bytes it used.
+func (dec *frameDecoder) decode(data []byte) (sjson.Value, int, error) {
+	dec.lock.Lock()
+	defer dec.lock.Unlock()
+
+	if dec.lex == nil {
+		dec.lex = sjson.NewLexer(nil)
+	}
+	dec.lex.ResetBytes(data)
+
+	val, err := sjson.Decode(dec.lex)
+	if err != nil {
+		return nil, 0, err
+	}
+	return val, dec.lex.Offset(), nil
+}
+
+// splitBinary decodes the header of a binary frame and returns the payload
+// as a slice of data.
+func (dec *frameDecoder) splitBinary(data []byte) (sjson.Value, []byte, error) {
+	header, n, err := dec.decode(data)
+	if err != nil {
+		return nil, nil, ErrInvalidBinaryMessage
+	}
+
+	if _, ok := header.(map[string]sjson.Value); !ok {
+		return nil, nil, ErrInvalidBinaryMessage
+	}
+
+	if n >= len(data) || data[n] != 0 {
+		return nil, nil, ErrInvalidBinaryMessage
+	}
+	return header, data[n+1:], nil
+}
+
+var decoderPool = sync.Pool{New: func() interface{} { return new(frameDecoder) }}
@@ -0,0 +1,155 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/console/consoletest"
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+var (
+	benchMessage = map[string]sjson.Value{
+		"type":         "message",
+		"message_type": "log",
+		"level":        "info",
+		"system":       "Lua",
+		"message":      "The quick brown fox jumps over the lazy dog",
+	}
+	benchHeader  = map[string]sjson.Value{"type": "frame_capture", "id": 1, "tap": 0, "num_taps": 1, "stride": 256}
+	benchPayload = make([]byte, 64*1024)
+)
+
+func encodeFrame(b *testing.B, v sjson.Value, payload []byte) []byte {
+	var buf bytes.Buffer
+	if err := sjson.Encode(&buf, v); err != nil {
+		b.Fatal(err)
+	}
+	if payload != nil {
+		buf.WriteByte(0)
+		buf.Write(payload)
+	}
+	return buf.Bytes()
+}
+
+func TestFrameDecoder(t *testing.T) {
+	var dec frameDecoder
+	for _, data := range []string{"{a=1}", " {b=\"x\"} // trailing", "[1 2 3]"} {
+		if _, _, err := dec.decode([]byte(data)); err != nil {
+			t.Errorf("%q: %v", data, err)
+		}
+	}
+
+	if _, n, _ := dec.decode([]byte("{a=1}\x00\x01")); n != 5 {
+		t.Errorf("unexpected header length: %d", n)
+	}
+	if _, _, err := dec.decode([]byte("{a=")); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func BenchmarkDecodeText(b *testing.B) {
+	var dec frameDecoder
+	data := encodeFrame(b, benchMessage, nil)
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := dec.decode(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeBinary(b *testing.B) {
+	var dec frameDecoder
+	data := encodeFrame(b, benchHeader, benchPayload)
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := dec.splitBinary(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkReceive(b *testing.B, send func(e *consoletest.Engine) error, size int, receive func(con *Console) error) {
+	engine := consoletest.NewEngine()
+	defer engine.Close()
+
+	con, err := NewConsole(engine.Addr(), "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer con.Close()
+
+	if !engine.WaitForClients(1, time.Second) {
+		b.Fatal("client did not connect")
+	}
+
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			if send(engine) != nil {
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < b.N; i++ {
+		if err := receive(con); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// The engine side of the connection is included in the allocations.
+func receivePublic(con *Console) error {
+	_, _, err := con.Receive()
+	return err
+}
+
+func receiveBuffered(con *Console) error {
+	_, _, err := con.receive()
+	return err
+}
+
+func BenchmarkReceiveText(b *testing.B) {
+	benchmarkReceive(b, func(e *consoletest.Engine) error {
+		return e.Send(benchMessage)
+	}, len(encodeFrame(b, benchMessage, nil)), receivePublic)
+}
+
+func BenchmarkReceiveBinary(b *testing.B) {
+	benchmarkReceive(b, func(e *consoletest.Engine) error {
+		return e.SendBinary(benchHeader, benchPayload)
+	}, len(encodeFrame(b, benchHeader, benchPayload)), receivePublic)
+}
+
+func BenchmarkReceiveBinaryBuffered(b *testing.B) {
+	benchmarkReceive(b, func(e *consoletest.Engine) error {
+		return e.SendBinary(benchHeader, benchPayload)
+	}, len(encodeFrame(b, benchHeader, benchPayload)), receiveBuffered)
+}
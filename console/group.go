@@ -0,0 +1,180 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+// GroupError collects the errors of the individual hosts in a group operation.
+type GroupError map[string]error
+
+func (e GroupError) Error() string {
+	var hosts []string
+	for host := range e {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	msgs := make([]string, len(hosts))
+	for i, host := range hosts {
+		msgs[i] = fmt.Sprintf("%s: %v", host, e[host])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// GroupMessage is a log message tagged with the host it came from.
+// If Err is set the stream from Host has ended.
+type GroupMessage struct {
+	Message
+	Host string
+	Err  error
+}
+
+func (m GroupMessage) String() string {
+	return fmt.Sprintf("%s %v", m.Host, m.Message)
+}
+
+// Group manages connections to many engines.
+type Group struct {
+	lock     sync.Mutex
+	consoles []*Console
+}
+
+func (g *Group) Add(con *Console) {
+	g.lock.Lock()
+	g.consoles = append(g.consoles, con)
+	g.lock.Unlock()
+}
+
+func (g *Group) Consoles() []*Console {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return append([]*Console(nil), g.consoles...)
+}
+
+func (g *Group) each(f func(con *Console) error) error {
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+		errs = make(GroupError)
+	)
+
+	for _, con := range g.Consoles() {
+		wg.Add(1)
+		go func(con *Console) {
+			defer wg.Done()
+			if err := f(con); err != nil {
+				lock.Lock()
+				errs[con.Host()] = err
+				lock.Unlock()
+			}
+		}(con)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// SendCommand sends to all engines concurrently. A GroupError is returned if any send failed.
+func (g *Group) SendCommand(ty CommandType, command string) error {
+	return g.each(func(con *Console) error {
+		return con.SendCommand(ty, command)
+	})
+}
+
+func (g *Group) SendCommandArgs(name string, args ...sjson.Value) error {
+	return g.each(func(con *Console) error {
+		return con.SendCommandArgs(name, args...)
+	})
+}
+
+// ReceiveMessages merges the message streams of all engines. The channel is
+// closed when every stream has ended.
+func (g *Group) ReceiveMessages(filter Filter) <-chan GroupMessage {
+	var wg sync.WaitGroup
+	ch := make(chan GroupMessage)
+
+	for _, con := range g.Consoles() {
+		wg.Add(1)
+		go func(con *Console) {
+			defer wg.Done()
+			for {
+				msg, err := con.ReceiveFilteredMessage(filter)
+				ch <- GroupMessage{msg, con.Host(), err}
+				if err != nil {
+					return
+				}
+			}
+		}(con)
+	}
+
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+	return ch
+}
+
+func (g *Group) Close() {
+	g.each(func(con *Console) error {
+		con.Close()
+		return nil
+	})
+}
+
+// NewGroup connects to all hosts concurrently. If some connections fail,
+// the group of successful connections is returned together with a GroupError.
+func NewGroup(hosts []string, protocol string) (*Group, error) {
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+		errs = make(GroupError)
+		g    = &Group{}
+	)
+
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			con, err := NewConsole(host, protocol)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				errs[host] = err
+			} else {
+				g.consoles = append(g.consoles, con)
+			}
+		}(host)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return g, errs
+	}
+	return g, nil
+}
@@ -0,0 +1,70 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"testing"
+
+	"github.com/andreas-jonsson/go-stingray/console/consoletest"
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+func TestGroup(t *testing.T) {
+	var hosts []string
+	for i := 0; i < 3; i++ {
+		engine := consoletest.NewEngine()
+		defer engine.Close()
+
+		engine.HandleCommand("hello", func(e *consoletest.Engine, args []sjson.Value) {
+			e.Log("info", "Test", args[0].(string))
+		})
+		hosts = append(hosts, engine.Addr())
+	}
+
+	g, err := NewGroup(append(hosts, "127.0.0.1:1"), "")
+	if _, ok := err.(GroupError); !ok || len(err.(GroupError)) != 1 {
+		t.Fatalf("expected one failed host: %v", err)
+	}
+	if len(g.Consoles()) != len(hosts) {
+		t.Fatal("missing connections")
+	}
+
+	messages := g.ReceiveMessages(nil)
+	if err := g.SendCommand(Command, "hello world"); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]bool)
+	for len(seen) < len(hosts) {
+		msg := <-messages
+		if msg.Err != nil {
+			t.Fatal(msg.Err)
+		}
+		if msg.Message.Message != "world" {
+			t.Errorf("unexpected message: %v", msg)
+		}
+		seen[msg.Host] = true
+	}
+
+	g.Close()
+	for msg := range messages {
+		if msg.Err == nil {
+			t.Errorf("unexpected message: %v", msg)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	DefaultHeartbeatInterval = 2 * time.Second
+	DefaultHeartbeatTimeout  = 6 * time.Second
+)
+
+// ErrPeerUnresponsive is returned by receive calls when nothing, not even a
+// pong, has been read from the engine within the heartbeat timeout.
+var ErrPeerUnresponsive = errors.New("peer unresponsive")
+
+func marshalPing(interface{}) ([]byte, byte, error) {
+	return nil, websocket.PingFrame, nil
+}
+
+var pingCodec = websocket.Codec{Marshal: marshalPing}
+
+// liveConn applies a rolling read deadline so that any traffic from the
+// peer, including pong frames handled inside the websocket package, keeps
+// the connection alive.
+type liveConn struct {
+	net.Conn
+
+	lock         sync.Mutex
+	timeout      time.Duration
+	userDeadline time.Time
+}
+
+func (c *liveConn) Read(p []byte) (int, error) {
+	c.lock.Lock()
+	deadline := c.userDeadline
+	heartbeat := false
+	if c.timeout > 0 {
+		if t := time.Now().Add(c.timeout); deadline.IsZero() || t.Before(deadline) {
+			deadline = t
+			heartbeat = true
+		}
+	}
+	c.lock.Unlock()
+
+	if err := c.Conn.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+
+	n, err := c.Conn.Read(p)
+	if e, ok := err.(net.Error); ok && e.Timeout() && heartbeat {
+		return n, ErrPeerUnresponsive
+	}
+	return n, err
+}
+
+func (c *liveConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *liveConn) SetReadDeadline(t time.Time) error {
+	c.lock.Lock()
+	c.userDeadline = t
+	c.lock.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *liveConn) setTimeout(timeout time.Duration) {
+	c.lock.Lock()
+	c.timeout = timeout
+	c.lock.Unlock()
+}
+
+// StartHeartbeat sends a ping every interval and makes receive calls fail
+// with ErrPeerUnresponsive if the engine is silent for longer than timeout.
+// The timeout should be a few intervals long.
+func (con *Console) StartHeartbeat(interval, timeout time.Duration) {
+	con.heartbeatLock.Lock()
+	defer con.heartbeatLock.Unlock()
+
+	con.stopHeartbeat()
+	con.conn.setTimeout(timeout)
+
+	stop := make(chan struct{})
+	con.heartbeat = stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := pingCodec.Send(con.ws, nil); err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// SetHeartbeatTimeout starts a heartbeat that pings every third of timeout,
+// or stops it if timeout is zero.
+func (con *Console) SetHeartbeatTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		con.StopHeartbeat()
+		return
+	}
+	con.StartHeartbeat(timeout/3, timeout)
+}
+
+func (con *Console) StopHeartbeat() {
+	con.heartbeatLock.Lock()
+	con.stopHeartbeat()
+	con.heartbeatLock.Unlock()
+}
+
+func (con *Console) stopHeartbeat() {
+	if con.heartbeat != nil {
+		close(con.heartbeat)
+		con.heartbeat = nil
+	}
+	con.conn.setTimeout(0)
+}
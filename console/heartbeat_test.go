@@ -0,0 +1,121 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestHeartbeatAlive(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+
+	con.StartHeartbeat(10*time.Millisecond, 50*time.Millisecond)
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		engine.Log("info", "Test", "still here")
+	}()
+
+	msg, err := con.ReceiveMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Message != "still here" {
+		t.Errorf("unexpected message: %v", msg)
+	}
+}
+
+func TestHeartbeatUnresponsive(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	con, err := NewConsole(strings.TrimPrefix(srv.URL, "http://"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Close()
+
+	con.StartHeartbeat(10*time.Millisecond, 50*time.Millisecond)
+
+	start := time.Now()
+	if _, _, err := con.Receive(); err != ErrPeerUnresponsive {
+		t.Fatalf("expected unresponsive peer, got: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("detection took too long")
+	}
+}
+
+func TestUserDeadline(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+
+	con.StartHeartbeat(10*time.Millisecond, time.Second)
+	con.SetDeadline(time.Now().Add(50 * time.Millisecond))
+
+	if _, _, err := con.Receive(); err == nil || err == ErrPeerUnresponsive {
+		t.Fatalf("expected deadline error, got: %v", err)
+	}
+}
+
+func TestHeartbeatConcurrent(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				con.StartHeartbeat(time.Millisecond, time.Second)
+				con.StopHeartbeat()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSetHeartbeatTimeout(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+
+	con.SetHeartbeatTimeout(60 * time.Millisecond)
+	if con.heartbeat == nil {
+		t.Fatal("heartbeat not started")
+	}
+	con.SetHeartbeatTimeout(0)
+	if con.heartbeat != nil {
+		t.Error("heartbeat not stopped")
+	}
+}
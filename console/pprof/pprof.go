@@ -0,0 +1,230 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package pprof converts profiler scope trees to gzipped pprof profiles,
+// readable by go tool pprof.
+package pprof
+
+import (
+	"compress/gzip"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+)
+
+// Field numbers from profile.proto.
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+	sampleLabel      = 3
+
+	labelKey = 1
+	labelStr = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+)
+
+type sample struct {
+	thread string
+	stack  []uint64
+	count,
+	nanos int64
+}
+
+// Builder accumulates frames into one profile. Each scope path becomes a
+// stack, with the exclusive time of the scope as the sample value, so pprof
+// reports inclusive time as the cumulative value.
+type Builder struct {
+	// Start is recorded as the profile time, if set.
+	Start time.Time
+
+	strings   []string
+	stringIDs map[string]int64
+	functions map[string]uint64
+	samples   map[string]*sample
+	keys      []string
+	duration  float64
+}
+
+func (b *Builder) stringID(s string) int64 {
+	if id, ok := b.stringIDs[s]; ok {
+		return id
+	}
+	id := int64(len(b.strings))
+	b.strings = append(b.strings, s)
+	b.stringIDs[s] = id
+	return id
+}
+
+// functionID returns the ID of the function, which is also used as the ID of
+// its only location.
+func (b *Builder) functionID(name string) uint64 {
+	if id, ok := b.functions[name]; ok {
+		return id
+	}
+	id := uint64(len(b.functions) + 1)
+	b.functions[name] = id
+	return id
+}
+
+func (b *Builder) add(s *console.Scope, stack []uint64) {
+	stack = append(stack, b.functionID(s.Scope))
+
+	// Stacks are stored leaf first.
+	leafFirst := make([]uint64, len(stack))
+	for i, id := range stack {
+		leafFirst[len(stack)-1-i] = id
+	}
+
+	key := s.Thread + "\x00" + strings.Join(s.Path(), "\x00")
+	smp, ok := b.samples[key]
+	if !ok {
+		smp = &sample{thread: s.Thread, stack: leafFirst}
+		b.samples[key] = smp
+		b.keys = append(b.keys, key)
+	}
+	smp.count++
+	smp.nanos += int64(math.Round(s.Exclusive * 1e9))
+
+	for _, c := range s.Children {
+		b.add(c, stack)
+	}
+}
+
+func (b *Builder) AddFrame(frame *console.ProfilerFrame) {
+	b.duration += frame.Duration()
+	for _, t := range frame.Threads {
+		for _, root := range t.Roots {
+			b.add(root, nil)
+		}
+	}
+}
+
+func (b *Builder) encode() []byte {
+	var p protoBuffer
+
+	valueType := func(field int, ty, unit string) {
+		tyID, unitID := b.stringID(ty), b.stringID(unit)
+		p.message(field, func(m *protoBuffer) {
+			m.int64(valueTypeType, tyID)
+			m.int64(valueTypeUnit, unitID)
+		})
+	}
+	valueType(profileSampleType, "scopes", "count")
+	valueType(profileSampleType, "time", "nanoseconds")
+
+	threadKey := b.stringID("thread")
+	for _, key := range b.keys {
+		smp := b.samples[key]
+		thread := b.stringID(smp.thread)
+		p.message(profileSample, func(m *protoBuffer) {
+			m.packedUint64(sampleLocationID, smp.stack)
+			m.packedInt64(sampleValue, []int64{smp.count, smp.nanos})
+			m.message(sampleLabel, func(l *protoBuffer) {
+				l.int64(labelKey, threadKey)
+				l.int64(labelStr, thread)
+			})
+		})
+	}
+
+	names := make([]string, len(b.functions))
+	for name, id := range b.functions {
+		names[id-1] = name
+	}
+	for i, name := range names {
+		id := uint64(i + 1)
+		p.message(profileLocation, func(m *protoBuffer) {
+			m.uint64(locationID, id)
+			m.message(locationLine, func(l *protoBuffer) {
+				l.uint64(lineFunctionID, id)
+			})
+		})
+
+		nameID := b.stringID(name)
+		p.message(profileFunction, func(m *protoBuffer) {
+			m.uint64(functionID, id)
+			m.int64(functionName, nameID)
+			m.int64(functionSystemName, nameID)
+		})
+	}
+
+	if !b.Start.IsZero() {
+		p.int64(profileTimeNanos, b.Start.UnixNano())
+	}
+	p.int64(profileDurationNanos, int64(math.Round(b.duration*1e9)))
+	valueType(profilePeriodType, "time", "nanoseconds")
+	p.int64(profilePeriod, 1)
+
+	// The string table goes last, since the fields above add to it.
+	for _, s := range b.strings {
+		p.string(profileStringTable, s)
+	}
+	return p.data
+}
+
+// Write writes the profile gzipped, as expected by pprof.
+func (b *Builder) Write(writer io.Writer) error {
+	zw := gzip.NewWriter(writer)
+	if _, err := zw.Write(b.encode()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func NewBuilder() *Builder {
+	b := &Builder{
+		stringIDs: make(map[string]int64),
+		functions: make(map[string]uint64),
+		samples:   make(map[string]*sample),
+	}
+
+	// The first string must be empty.
+	b.stringID("")
+	return b
+}
+
+// WriteFrames is a shorthand for building a profile from frames and writing it.
+func WriteFrames(writer io.Writer, frames []*console.ProfilerFrame) error {
+	b := NewBuilder()
+	for _, f := range frames {
+		b.AddFrame(f)
+	}
+	return b.Write(writer)
+}
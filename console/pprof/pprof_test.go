@@ -0,0 +1,110 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package pprof
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/consoletest/profiletest"
+)
+
+type field struct {
+	num   int
+	value uint64
+	data  []byte
+}
+
+func decodeFields(t *testing.T, data []byte) []field {
+	var fields []field
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		data = data[n:]
+
+		f := field{num: int(key >> 3)}
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			t.Fatal("invalid varint")
+		}
+		data = data[n:]
+
+		switch key & 7 {
+		case wireVarint:
+			f.value = v
+		case wireBytes:
+			f.data, data = data[:v], data[v:]
+		default:
+			t.Fatalf("unexpected wire type: %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func TestWriteFrames(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFrames(&buf, []*console.ProfilerFrame{profiletest.Frame(), profiletest.Frame()}); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		strings []string
+		samples [][]field
+		numFunc int
+	)
+	for _, f := range decodeFields(t, data) {
+		switch f.num {
+		case profileStringTable:
+			strings = append(strings, string(f.data))
+		case profileSample:
+			samples = append(samples, decodeFields(t, f.data))
+		case profileFunction:
+			numFunc++
+		}
+	}
+
+	if strings[0] != "" || numFunc != 4 || len(samples) != 4 {
+		t.Fatalf("unexpected profile: %q, %d functions, %d samples", strings, numFunc, len(samples))
+	}
+
+	// The update sample has the stack update, frame and was seen in both frames.
+	update := samples[1]
+	if update[0].num != sampleLocationID || !reflect.DeepEqual(update[0].data, []byte{2, 1}) {
+		t.Errorf("unexpected stack: %v", update[0].data)
+	}
+	if update[1].num != sampleValue || !bytes.HasPrefix(update[1].data, []byte{2}) {
+		t.Errorf("unexpected values: %v", update[1].data)
+	}
+	if v, _ := binary.Uvarint(update[1].data[1:]); v != 8000000 {
+		t.Errorf("unexpected time: %d", v)
+	}
+}
@@ -18,15 +18,32 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package console
 
 import (
-	"bytes"
+	"context"
 	"encoding/binary"
+	"math"
+	"sync"
+	"time"
 
 	"github.com/andreas-jonsson/go-stingray/sjson"
 )
 
+// ProfilerEventSize is the size of an encoded ProfilerEvent.
+const ProfilerEventSize = 60
+
 type (
+	// Profiler streams profiler events from a console connection.
 	Profiler struct {
-		con *Console
+		con    *Console
+		tables *ProfilerTables
+		ingest *ProfilerSession
+
+		events  chan []ProfilerEvent
+		buffers [2][]ProfilerEvent
+		next    int
+
+		lock    sync.Mutex
+		started bool
+		err     error
 	}
 
 	ProfilerEvent struct {
@@ -47,33 +64,195 @@ type (
 	}
 )
 
-func (prof *Profiler) Pull(pe *ProfilerEvent) (sjson.Value, *ProfilerEvent, error) {
+// UnmarshalBinary decodes a big-endian event of ProfilerEventSize bytes.
+func (ev *ProfilerEvent) UnmarshalBinary(data []byte) error {
+	if len(data) < ProfilerEventSize {
+		return ErrInvalidProfilerData
+	}
+
+	be := binary.BigEndian
+	ev.Type = be.Uint32(data[0:])
+	ev.Name = be.Uint64(data[4:])
+	ev.ThreadID = be.Uint32(data[12:])
+	ev.CoreID = be.Uint32(data[16:])
+	ev.Parent = int32(be.Uint32(data[20:]))
+	ev.FirstChild = int32(be.Uint32(data[24:]))
+	ev.LastChild = int32(be.Uint32(data[28:]))
+	ev.PrevSibling = int32(be.Uint32(data[32:]))
+	ev.NextSibling = int32(be.Uint32(data[36:]))
+	ev.Time = math.Float64frombits(be.Uint64(data[40:]))
+	ev.Elapsed = math.Float64frombits(be.Uint64(data[48:]))
+	ev.Count = be.Uint32(data[56:])
+	return nil
+}
+
+func (ev *ProfilerEvent) appendBinary(data []byte) []byte {
+	var buf [ProfilerEventSize]byte
+
+	be := binary.BigEndian
+	be.PutUint32(buf[0:], ev.Type)
+	be.PutUint64(buf[4:], ev.Name)
+	be.PutUint32(buf[12:], ev.ThreadID)
+	be.PutUint32(buf[16:], ev.CoreID)
+	be.PutUint32(buf[20:], uint32(ev.Parent))
+	be.PutUint32(buf[24:], uint32(ev.FirstChild))
+	be.PutUint32(buf[28:], uint32(ev.LastChild))
+	be.PutUint32(buf[32:], uint32(ev.PrevSibling))
+	be.PutUint32(buf[36:], uint32(ev.NextSibling))
+	be.PutUint64(buf[40:], math.Float64bits(ev.Time))
+	be.PutUint64(buf[48:], math.Float64bits(ev.Elapsed))
+	be.PutUint32(buf[56:], ev.Count)
+	return append(data, buf[:]...)
+}
+
+func (ev *ProfilerEvent) MarshalBinary() ([]byte, error) {
+	return ev.appendBinary(make([]byte, 0, ProfilerEventSize)), nil
+}
+
+// profilerData reports whether a binary frame holds profiler events. The
+// engine sends them without a header, so frames that are not a whole number
+// of events, or that split as a tagged binary message, belong to someone else.
+func (con *Console) profilerData(data []byte) bool {
+	if len(data) == 0 || len(data)%ProfilerEventSize != 0 {
+		return false
+	}
+	if data[0] == '{' {
+		if _, _, err := con.decoder.splitBinary(data); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeProfilerEvents decodes every event in data, reusing events if it is
+// large enough.
+func decodeProfilerEvents(data []byte, events []ProfilerEvent) ([]ProfilerEvent, error) {
+	if len(data)%ProfilerEventSize != 0 {
+		return nil, ErrInvalidProfilerData
+	}
+
+	n := len(data) / ProfilerEventSize
+	if cap(events) < n {
+		events = make([]ProfilerEvent, n)
+	}
+	events = events[:n]
+
+	for i := range events {
+		events[i].UnmarshalBinary(data[i*ProfilerEventSize:])
+	}
+	return events, nil
+}
+
+// Tables returns the string and thread tables received by Pull or the stream.
+func (prof *Profiler) Tables() *ProfilerTables {
+	return prof.tables
+}
+
+// Pull returns either a profiler_strings or profiler_threads value, which
+// has also been added to the tables, or all events in a binary frame.
+// Other binary frames are skipped. The events are only valid until the next call.
+func (prof *Profiler) Pull() (sjson.Value, []ProfilerEvent, error) {
 	for {
-		val, data, err := prof.con.Receive()
+		val, data, err := prof.con.receive()
 		if err != nil {
 			return nil, nil, err
 		}
 
-		if len(data) > 0 {
-			if pe != nil {
-				if err := binary.Read(bytes.NewReader(data), binary.BigEndian, pe); err != nil {
-					return nil, nil, err
-				}
+		if data != nil {
+			if !prof.con.profilerData(data) {
+				continue
+			}
+
+			buf := &prof.buffers[prof.next]
+			prof.next = 1 - prof.next
+
+			if *buf, err = decodeProfilerEvents(data, *buf); err != nil {
+				return nil, nil, err
 			}
-			return pe, nil, nil
+			return nil, *buf, nil
+		}
+
+		if ok, err := prof.ingest.Ingest(val); err != nil {
+			return nil, nil, err
+		} else if ok {
+			return val, nil, nil
+		}
+	}
+}
+
+func (prof *Profiler) setErr(err error) {
+	prof.lock.Lock()
+	prof.err = err
+	prof.lock.Unlock()
+}
+
+// Err returns the error that stopped the stream, after the events channel
+// has been closed. It is nil if the stream has not stopped or was cancelled.
+func (prof *Profiler) Err() error {
+	prof.lock.Lock()
+	defer prof.lock.Unlock()
+	return prof.err
+}
+
+// Start streams events in the background until ctx is done or receiving fails.
+// Cancelling ctx interrupts a pending receive, which can leave the connection
+// in the middle of a frame, so the console should be closed afterwards.
+func (prof *Profiler) Start(ctx context.Context) {
+	prof.lock.Lock()
+	defer prof.lock.Unlock()
+
+	if prof.started {
+		return
+	}
+	prof.started = true
+
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			prof.con.SetDeadline(time.Unix(1, 0))
+		case <-stop:
 		}
+	}()
+
+	go func() {
+		defer close(prof.events)
+		defer close(stop)
 
-		if m, ok := val.(map[string]sjson.Value); ok {
-			if ty, ok := m["type"]; ok {
-				switch ty {
-				case "profiler_strings", "profiler_threads":
-					return val, nil, nil
+		for {
+			_, events, err := prof.Pull()
+			if err != nil {
+				if ctx.Err() == nil {
+					prof.setErr(err)
 				}
+				return
+			}
+			if events == nil {
+				continue
+			}
+
+			select {
+			case prof.events <- events:
+			case <-ctx.Done():
+				return
 			}
 		}
-	}
+	}()
+}
+
+// Events returns the channel of event batches, one per binary frame. Each batch
+// is only valid until the next receive from the channel, since the buffers
+// are reused. The channel is closed when the stream stops.
+func (prof *Profiler) Events() <-chan []ProfilerEvent {
+	return prof.events
 }
 
 func NewProfiler(con *Console) *Profiler {
-	return &Profiler{con}
+	session := NewProfilerSession(con)
+	return &Profiler{
+		con:    con,
+		tables: session.ProfilerTables,
+		ingest: session,
+		events: make(chan []ProfilerEvent),
+	}
 }
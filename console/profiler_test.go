@@ -0,0 +1,158 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+var testProfilerEvents = []ProfilerEvent{
+	{1, 0x0102030405060708, 7, 2, -1, 1, 1, -1, -1, 0.5, 0.016, 1},
+	{2, 42, 7, 3, 0, -1, -1, -1, -1, 0.501, -0.25, 0xffffffff},
+}
+
+func TestProfilerEventBinary(t *testing.T) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, testProfilerEvents)
+	if buf.Len() != len(testProfilerEvents)*ProfilerEventSize {
+		t.Fatalf("unexpected event size: %d", buf.Len())
+	}
+
+	events, err := decodeProfilerEvents(buf.Bytes(), nil)
+	if err != nil || !reflect.DeepEqual(events, testProfilerEvents) {
+		t.Errorf("unexpected events: %+v, %v", events, err)
+	}
+
+	data, _ := testProfilerEvents[1].MarshalBinary()
+	if !bytes.Equal(data, buf.Bytes()[ProfilerEventSize:]) {
+		t.Errorf("unexpected encoding: %x", data)
+	}
+
+	if err := new(ProfilerEvent).UnmarshalBinary(data[1:]); err != ErrInvalidProfilerData {
+		t.Errorf("expected invalid data, got: %v", err)
+	}
+}
+
+func TestProfilerPull(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+
+	prof := NewProfiler(con)
+	engine.Log("info", "Lua", "ignored")
+	engine.SendProfilerStrings(map[uint64]string{42: "render"})
+	engine.SendProfilerEvents(testProfilerEvents)
+
+	val, events, err := prof.Pull()
+	if val == nil || events != nil || err != nil {
+		t.Fatalf("expected string table, got: %v %v %v", val, events, err)
+	}
+	if name, _ := prof.Tables().ScopeName(42); name != "render" {
+		t.Errorf("unexpected scope name: %s", name)
+	}
+
+	val, events, err = prof.Pull()
+	if val != nil || err != nil || !reflect.DeepEqual(events, testProfilerEvents) {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}
+
+func TestProfilerEvents(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	prof := NewProfiler(con)
+	prof.Start(ctx)
+
+	for i := 0; i < 4; i++ {
+		engine.SendProfilerEvents(testProfilerEvents[:i%2+1])
+	}
+
+	for i := 0; i < 4; i++ {
+		events := <-prof.Events()
+		if !reflect.DeepEqual(events, testProfilerEvents[:i%2+1]) {
+			t.Errorf("batch %d: unexpected events: %+v", i, events)
+		}
+	}
+
+	cancel()
+	select {
+	case _, ok := <-prof.Events():
+		if ok {
+			t.Error("unexpected events after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stream did not stop")
+	}
+	if err := prof.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestProfilerEventsSkip(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	prof := NewProfiler(con)
+	prof.Start(ctx)
+
+	// A tagged binary message padded to a whole number of events.
+	header := map[string]sjson.Value{"type": "frame_capture"}
+	payload := make([]byte, 2*ProfilerEventSize-len(`{"type":"frame_capture"}`)-1)
+
+	engine.SendProfilerEvents([]byte{1, 2, 3})
+	engine.SendBinary(header, payload)
+	engine.SendProfilerEvents(testProfilerEvents)
+
+	if events := <-prof.Events(); !reflect.DeepEqual(events, testProfilerEvents) {
+		t.Errorf("unexpected events: %+v", events)
+	}
+	if err := prof.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func BenchmarkDecodeProfilerEvents(b *testing.B) {
+	var buf bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		binary.Write(&buf, binary.BigEndian, testProfilerEvents)
+	}
+	data := buf.Bytes()
+
+	var events []ProfilerEvent
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		events, _ = decodeProfilerEvents(data, events)
+	}
+}
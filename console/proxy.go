@@ -0,0 +1,249 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/sjson"
+	"golang.org/x/net/websocket"
+)
+
+const proxyClientQueueSize = 256
+
+type Direction int
+
+const (
+	FromEngine Direction = iota
+	ToEngine
+)
+
+func (d Direction) String() string {
+	if d == ToEngine {
+		return "->"
+	}
+	return "<-"
+}
+
+// TapFrame is a frame observed by a proxy. Client is empty for frames from
+// the engine, since those are sent to all clients.
+type TapFrame struct {
+	Direction Direction
+	Time      time.Time
+	Client    string
+	Binary    bool
+	Data      []byte
+}
+
+type proxyClient struct {
+	ws     *websocket.Conn
+	frames chan rawFrame
+}
+
+// Proxy shares one upstream engine connection between any number of
+// downstream websocket clients speaking the console protocol.
+type Proxy struct {
+	// Logger receives connection events and forwarded commands. May be nil.
+	Logger *log.Logger
+
+	// Tap, if set, is called with every frame passing through the proxy.
+	// It must not modify the frame data.
+	Tap func(f TapFrame)
+
+	con     *Console
+	handler websocket.Handler
+
+	lock    sync.Mutex
+	clients map[*proxyClient]struct{}
+	stopped bool
+}
+
+func (p *Proxy) logf(format string, v ...interface{}) {
+	if p.Logger != nil {
+		p.Logger.Printf(format, v...)
+	}
+}
+
+// addClient registers c, or returns false if the upstream connection has
+// already failed.
+func (p *Proxy) addClient(c *proxyClient) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.stopped {
+		return false
+	}
+	p.clients[c] = struct{}{}
+	return true
+}
+
+func (p *Proxy) isStopped() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.stopped
+}
+
+func (p *Proxy) removeClient(c *proxyClient) {
+	p.lock.Lock()
+	if _, ok := p.clients[c]; ok {
+		delete(p.clients, c)
+		close(c.frames)
+	}
+	p.lock.Unlock()
+}
+
+func (p *Proxy) broadcast(f rawFrame) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for c := range p.clients {
+		select {
+		case c.frames <- f:
+		default:
+			p.logf("%s: client is not keeping up, disconnecting", c.ws.Request().RemoteAddr)
+			delete(p.clients, c)
+			close(c.frames)
+		}
+	}
+}
+
+func describeCommand(data []byte) string {
+	val, err := sjson.Decode(sjson.NewLexer(bytes.NewReader(data)))
+	if err != nil {
+		return string(data)
+	}
+
+	if m, ok := val.(map[string]sjson.Value); ok {
+		switch m["type"] {
+		case "command":
+			var buf bytes.Buffer
+			buf.WriteString("command: ")
+			buf.WriteString(toString(m["command"]))
+			if args, ok := m["arg"].([]sjson.Value); ok {
+				for _, arg := range args {
+					buf.WriteByte(' ')
+					buf.WriteString(toString(arg))
+				}
+			}
+			return buf.String()
+		case "script":
+			return "script: " + toString(m["script"])
+		}
+	}
+	return string(data)
+}
+
+func toString(v sjson.Value) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+
+	var buf bytes.Buffer
+	sjson.Encode(&buf, v)
+	return buf.String()
+}
+
+func (p *Proxy) serveClient(ws *websocket.Conn) {
+	addr := ws.Request().RemoteAddr
+	c := &proxyClient{ws, make(chan rawFrame, proxyClientQueueSize)}
+
+	if !p.addClient(c) {
+		ws.Close()
+		return
+	}
+	defer p.removeClient(c)
+
+	p.logf("%s: connected", addr)
+	defer p.logf("%s: disconnected", addr)
+
+	go func() {
+		for f := range c.frames {
+			if err := consoleRawFrameCodec.Send(ws, &f); err != nil {
+				break
+			}
+		}
+		ws.Close()
+	}()
+
+	for {
+		var f rawFrame
+		if err := consoleRawFrameCodec.Receive(ws, &f); err != nil {
+			return
+		}
+
+		if f.ty == websocket.TextFrame {
+			p.logf("%s: %s", addr, describeCommand(f.data))
+		}
+		if p.Tap != nil {
+			p.Tap(TapFrame{ToEngine, time.Now(), addr, f.ty == websocket.BinaryFrame, f.data})
+		}
+
+		if err := p.con.sendFrame(f); err != nil {
+			p.logf("%s: could not forward upstream: %v", addr, err)
+			return
+		}
+	}
+}
+
+// ServeHTTP accepts downstream websocket clients. Once Run has returned,
+// clients are rejected with 503 Service Unavailable.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if p.isStopped() {
+		http.Error(w, "upstream connection closed", http.StatusServiceUnavailable)
+		return
+	}
+	p.handler.ServeHTTP(w, req)
+}
+
+// Run forwards engine frames to all connected clients until the upstream
+// connection fails.
+func (p *Proxy) Run() error {
+	for {
+		f, err := p.con.receiveFrame()
+		if err != nil {
+			p.lock.Lock()
+			p.stopped = true
+			for c := range p.clients {
+				delete(p.clients, c)
+				close(c.frames)
+			}
+			p.lock.Unlock()
+			return err
+		}
+		if p.Tap != nil {
+			p.Tap(TapFrame{FromEngine, time.Now(), "", f.ty == websocket.BinaryFrame, f.data})
+		}
+		p.broadcast(f)
+	}
+}
+
+func (p *Proxy) NumClients() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.clients)
+}
+
+func NewProxy(con *Console) *Proxy {
+	p := &Proxy{con: con, clients: make(map[*proxyClient]struct{})}
+	p.handler = websocket.Handler(p.serveClient)
+	return p
+}
@@ -0,0 +1,114 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+func TestProxy(t *testing.T) {
+	engine, upstream := startEngine(t)
+	defer engine.Close()
+	defer upstream.Close()
+	engine.Echo = true
+
+	taps := make(chan TapFrame, 8)
+	proxy := NewProxy(upstream)
+	proxy.Tap = func(f TapFrame) {
+		taps <- f
+	}
+	go proxy.Run()
+
+	srv := httptest.NewServer(proxy)
+	defer srv.Close()
+
+	var clients []*Console
+	for i := 0; i < 2; i++ {
+		con, err := NewConsole(strings.TrimPrefix(srv.URL, "http://"), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer con.Close()
+		clients = append(clients, con)
+	}
+
+	for proxy.NumClients() < len(clients) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := clients[0].SendCommand(Script, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]sjson.Value{"type": "script", "script": "test"}
+	for _, con := range clients {
+		receiveAndTest(t, con, expected)
+	}
+
+	for _, dir := range []Direction{ToEngine, FromEngine} {
+		if f := <-taps; f.Direction != dir || f.Binary || (dir == ToEngine) != (f.Client != "") {
+			t.Errorf("unexpected tap: %v", f)
+		}
+	}
+}
+
+func TestProxyUpstreamClosed(t *testing.T) {
+	engine, upstream := startEngine(t)
+	defer upstream.Close()
+
+	proxy := NewProxy(upstream)
+	done := make(chan error)
+	go func() {
+		done <- proxy.Run()
+	}()
+
+	srv := httptest.NewServer(proxy)
+	defer srv.Close()
+
+	con, err := NewConsole(strings.TrimPrefix(srv.URL, "http://"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Close()
+
+	engine.Close()
+	if err := <-done; err == nil {
+		t.Fatal("expected upstream error")
+	}
+	if _, _, err := con.Receive(); err == nil {
+		t.Error("expected connected client to be closed")
+	}
+
+	if _, err := NewConsole(strings.TrimPrefix(srv.URL, "http://"), ""); err == nil {
+		t.Error("expected new client to be rejected")
+	}
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status: %s", resp.Status)
+	}
+}
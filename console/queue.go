@@ -0,0 +1,357 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+const (
+	ackMarker = "@@stingray-ack:"
+
+	DefaultQueueSize  = 1024
+	DefaultAckTimeout = 5 * time.Second
+)
+
+var (
+	ErrQueueFull   = errors.New("send queue is full")
+	ErrQueueClosed = errors.New("send queue is closed")
+	ErrAckTimeout  = errors.New("timeout waiting for acknowledgement")
+)
+
+type QueueConfig struct {
+	// Rate limits commands per second, zero means unlimited.
+	Rate float64
+	// BatchSize is the number of commands sent before waiting for an
+	// acknowledgement. Defaults to one.
+	BatchSize int
+	// QueueSize is the number of commands that can be pending before
+	// Enqueue blocks. Defaults to DefaultQueueSize.
+	QueueSize int
+
+	// WaitForAck makes the queue send an echo marker script after each batch
+	// and wait for the engine to print it before continuing.
+	WaitForAck bool
+	AckTimeout time.Duration
+}
+
+type QueueStats struct {
+	Sent,
+	Acked,
+	Pending int
+	// Stalls counts Enqueue calls that blocked on a full queue, and
+	// Blocked is the total time spent waiting.
+	Stalls  int
+	Blocked time.Duration
+}
+
+// SendQueue paces commands to an engine. When WaitForAck is enabled, messages
+// received from the console must be passed to Observe.
+type SendQueue struct {
+	con    *Console
+	config QueueConfig
+
+	acks chan uint64
+	done chan struct{}
+
+	// cond is signalled when messages are added, sent or discarded.
+	lock    sync.Mutex
+	cond    *sync.Cond
+	queue   []sjson.Value
+	pending int
+	stats   QueueStats
+	err     error
+	closed  bool
+	nextID  uint64
+}
+
+func (q *SendQueue) setErr(err error) {
+	q.lock.Lock()
+	if q.err == nil {
+		q.err = err
+	}
+	q.lock.Unlock()
+}
+
+// Err returns the first send or acknowledgement error.
+func (q *SendQueue) Err() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.err
+}
+
+func (q *SendQueue) Stats() QueueStats {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	s := q.stats
+	s.Pending = len(q.queue)
+	return s
+}
+
+// check must be called with the lock held.
+func (q *SendQueue) check() error {
+	if q.closed {
+		return ErrQueueClosed
+	}
+	return q.err
+}
+
+// push must be called with the lock held, and the queue not full.
+func (q *SendQueue) push(msg sjson.Value) {
+	q.queue = append(q.queue, msg)
+	q.pending++
+	q.cond.Broadcast()
+}
+
+func (q *SendQueue) enqueue(msg sjson.Value) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if len(q.queue) >= q.config.QueueSize && q.check() == nil {
+		start := time.Now()
+		for len(q.queue) >= q.config.QueueSize && q.check() == nil {
+			q.cond.Wait()
+		}
+		q.stats.Stalls++
+		q.stats.Blocked += time.Since(start)
+	}
+
+	if err := q.check(); err != nil {
+		return err
+	}
+	q.push(msg)
+	return nil
+}
+
+// Enqueue adds a command to the queue, blocking while the queue is full.
+func (q *SendQueue) Enqueue(ty CommandType, command string) error {
+	msg, err := commandMessage(ty, command)
+	if err != nil {
+		return err
+	}
+	return q.enqueue(msg)
+}
+
+// TryEnqueue adds a command to the queue or returns ErrQueueFull.
+func (q *SendQueue) TryEnqueue(ty CommandType, command string) error {
+	msg, err := commandMessage(ty, command)
+	if err != nil {
+		return err
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if err := q.check(); err != nil {
+		return err
+	}
+	if len(q.queue) >= q.config.QueueSize {
+		return ErrQueueFull
+	}
+	q.push(msg)
+	return nil
+}
+
+// SendCommand is the same as Enqueue, so a queue can stand in for a Console.
+func (q *SendQueue) SendCommand(ty CommandType, command string) error {
+	return q.Enqueue(ty, command)
+}
+
+func (q *SendQueue) SendCommandArgs(name string, args ...sjson.Value) error {
+	return q.enqueue(commandArgsMessage(name, args))
+}
+
+// Flush waits until every enqueued command has been sent, and acknowledged
+// if WaitForAck is enabled.
+func (q *SendQueue) Flush() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for q.pending > 0 {
+		q.cond.Wait()
+	}
+	return q.err
+}
+
+// Observe inspects a received message for acknowledgement markers.
+// It returns true if the message was a marker and should not be displayed.
+func (q *SendQueue) Observe(msg Message) bool {
+	i := strings.Index(msg.Message, ackMarker)
+	if i < 0 {
+		return false
+	}
+
+	id, err := strconv.ParseUint(strings.TrimSpace(msg.Message[i+len(ackMarker):]), 10, 64)
+	if err != nil {
+		return false
+	}
+
+	select {
+	case q.acks <- id:
+	default:
+	}
+	return true
+}
+
+func (q *SendQueue) waitForAck() error {
+	q.nextID++
+	id := q.nextID
+
+	if err := q.con.SendCommand(Script, fmt.Sprintf("print(\"%s%d\")", ackMarker, id)); err != nil {
+		return err
+	}
+
+	timeout := time.NewTimer(q.config.AckTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case ack := <-q.acks:
+			if ack == id {
+				return nil
+			}
+		case <-timeout.C:
+			return ErrAckTimeout
+		case <-q.done:
+			return ErrQueueClosed
+		}
+	}
+}
+
+// next waits for messages and removes up to one batch from the queue. It
+// returns false, after discarding all pending messages, once the queue is closed.
+func (q *SendQueue) next(batch []sjson.Value) ([]sjson.Value, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for len(q.queue) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+
+	if q.closed {
+		q.pending -= len(q.queue)
+		q.queue = nil
+		q.cond.Broadcast()
+		return batch, false
+	}
+
+	n := len(q.queue)
+	if n > q.config.BatchSize {
+		n = q.config.BatchSize
+	}
+	batch = append(batch, q.queue[:n]...)
+	q.queue = q.queue[n:]
+	q.cond.Broadcast()
+	return batch, true
+}
+
+// release marks n messages as done, sent or not.
+func (q *SendQueue) release(n int) {
+	q.lock.Lock()
+	q.pending -= n
+	q.cond.Broadcast()
+	q.lock.Unlock()
+}
+
+func (q *SendQueue) run() {
+	var (
+		interval time.Duration
+		last     time.Time
+		batch    []sjson.Value
+		ok       bool
+	)
+
+	if q.config.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / q.config.Rate)
+	}
+
+	for {
+		if batch, ok = q.next(batch[:0]); !ok {
+			return
+		}
+
+		for _, msg := range batch {
+			if interval > 0 {
+				time.Sleep(time.Until(last.Add(interval)))
+				last = time.Now()
+			}
+
+			if q.Err() == nil {
+				if err := q.con.Send(msg); err != nil {
+					q.setErr(err)
+				} else {
+					q.lock.Lock()
+					q.stats.Sent++
+					q.lock.Unlock()
+				}
+			}
+		}
+
+		if q.config.WaitForAck && q.Err() == nil {
+			if err := q.waitForAck(); err != nil {
+				q.setErr(err)
+			} else {
+				q.lock.Lock()
+				q.stats.Acked += len(batch)
+				q.lock.Unlock()
+			}
+		}
+		q.release(len(batch))
+	}
+}
+
+// Close stops the queue, discarding commands not yet sent.
+func (q *SendQueue) Close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		close(q.done)
+		q.cond.Broadcast()
+	}
+}
+
+func NewSendQueue(con *Console, config QueueConfig) *SendQueue {
+	if config.BatchSize < 1 {
+		config.BatchSize = 1
+	}
+	if config.QueueSize < 1 {
+		config.QueueSize = DefaultQueueSize
+	}
+	if config.AckTimeout <= 0 {
+		config.AckTimeout = DefaultAckTimeout
+	}
+
+	q := &SendQueue{
+		con:    con,
+		config: config,
+		acks:   make(chan uint64, 1),
+		done:   make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.lock)
+	go q.run()
+	return q
+}
@@ -0,0 +1,182 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/console/consoletest"
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+var printPattern = regexp.MustCompile(`^print\("(.*)"\)$`)
+
+func TestSendQueueRate(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+
+	q := NewSendQueue(con, QueueConfig{Rate: 100})
+	defer q.Close()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := q.Enqueue(Command, fmt.Sprintf("cmd %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("rate limit not applied: %v", elapsed)
+	}
+
+	if !engine.WaitForMessages(5, time.Second) {
+		t.Fatal("commands not received")
+	}
+	for i, msg := range engine.Received() {
+		args := msg.(map[string]sjson.Value)["arg"].([]sjson.Value)
+		if args[0] != fmt.Sprint(i) {
+			t.Errorf("command %d out of order: %v", i, msg)
+		}
+	}
+
+	if s := q.Stats(); s.Sent != 5 || s.Pending != 0 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+}
+
+func TestSendQueueAck(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+
+	engine.HandleScript(func(e *consoletest.Engine, script string) {
+		if m := printPattern.FindStringSubmatch(script); m != nil {
+			e.Log("info", "Lua", m[1])
+		}
+	})
+
+	q := NewSendQueue(con, QueueConfig{BatchSize: 2, WaitForAck: true, AckTimeout: time.Second})
+	defer q.Close()
+
+	go func() {
+		for {
+			msg, err := con.ReceiveMessage()
+			if err != nil {
+				return
+			}
+			if !q.Observe(msg) {
+				t.Errorf("unexpected message: %v", msg)
+			}
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		q.Enqueue(Command, "cmd")
+	}
+	if err := q.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := q.Stats(); s.Acked != 4 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+}
+
+func TestSendQueueAckTimeout(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+
+	q := NewSendQueue(con, QueueConfig{WaitForAck: true, AckTimeout: 20 * time.Millisecond})
+	defer q.Close()
+
+	q.Enqueue(Command, "cmd")
+	if err := q.Flush(); err != ErrAckTimeout {
+		t.Fatalf("expected ack timeout, got: %v", err)
+	}
+	if err := q.Enqueue(Command, "cmd"); err != ErrAckTimeout {
+		t.Errorf("expected queue to report error, got: %v", err)
+	}
+}
+
+func TestSendQueueFull(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+
+	q := NewSendQueue(con, QueueConfig{Rate: 10, QueueSize: 1})
+	defer q.Close()
+
+	var full bool
+	for i := 0; i < 3 && !full; i++ {
+		full = q.TryEnqueue(Command, "cmd") == ErrQueueFull
+	}
+	if !full {
+		t.Error("expected full queue")
+	}
+
+	q.Close()
+	if err := q.Enqueue(Command, "cmd"); err != ErrQueueClosed {
+		t.Errorf("expected closed queue, got: %v", err)
+	}
+}
+
+func TestSendQueueCloseFlush(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+
+	for i := 0; i < 50; i++ {
+		q := NewSendQueue(con, QueueConfig{QueueSize: 2})
+
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for q.Enqueue(Command, "cmd") == nil {
+				}
+			}()
+		}
+		q.Close()
+		wg.Wait()
+
+		done := make(chan struct{})
+		go func() {
+			q.Flush()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("flush did not return after close")
+		}
+		if s := q.Stats(); s.Pending != 0 {
+			t.Fatalf("unexpected stats: %+v", s)
+		}
+	}
+}
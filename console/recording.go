@@ -0,0 +1,248 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// A recording starts with recordingMagic and the start time in unix
+// nanoseconds. Each frame is stored as a uvarint time delta in microseconds
+// from the previous frame, a frame type byte, a uvarint length and the payload.
+const (
+	recordingMagic = "SRCONREC"
+
+	recordedTextFrame   = 0
+	recordedBinaryFrame = 1
+
+	// maxRecordedFrameSize bounds the length read from a recording before
+	// allocating, well above the default websocket payload limit.
+	maxRecordedFrameSize = 256 << 20
+)
+
+var ErrInvalidRecording = errors.New("invalid recording")
+
+type RecordedFrame struct {
+	// Time is the offset from the start of the recording.
+	Time   time.Duration
+	Binary bool
+	Data   []byte
+}
+
+type Recorder struct {
+	lock   sync.Mutex
+	writer *bufio.Writer
+	start,
+	last time.Time
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (rec *Recorder) writeUvarint(v uint64) error {
+	n := binary.PutUvarint(rec.buf[:], v)
+	_, err := rec.writer.Write(rec.buf[:n])
+	return err
+}
+
+func (rec *Recorder) WriteFrame(t time.Time, bin bool, data []byte) error {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+
+	if t.Before(rec.last) {
+		t = rec.last
+	}
+
+	delta := t.Sub(rec.last) / time.Microsecond
+	rec.last = rec.last.Add(delta * time.Microsecond)
+
+	if err := rec.writeUvarint(uint64(delta)); err != nil {
+		return err
+	}
+
+	ty := byte(recordedTextFrame)
+	if bin {
+		ty = recordedBinaryFrame
+	}
+	if err := rec.writer.WriteByte(ty); err != nil {
+		return err
+	}
+
+	if err := rec.writeUvarint(uint64(len(data))); err != nil {
+		return err
+	}
+	_, err := rec.writer.Write(data)
+	return err
+}
+
+func (rec *Recorder) Flush() error {
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	return rec.writer.Flush()
+}
+
+func (rec *Recorder) Start() time.Time {
+	return rec.start
+}
+
+func NewRecorder(writer io.Writer) (*Recorder, error) {
+	rec := &Recorder{writer: bufio.NewWriter(writer), start: time.Now()}
+	rec.last = rec.start
+
+	if _, err := rec.writer.WriteString(recordingMagic); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(rec.writer, binary.BigEndian, rec.start.UnixNano()); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+type RecordingReader struct {
+	reader *bufio.Reader
+	start  time.Time
+	offset time.Duration
+}
+
+func (rr *RecordingReader) Start() time.Time {
+	return rr.start
+}
+
+// Next returns the next frame in the recording, or io.EOF at the end.
+func (rr *RecordingReader) Next() (RecordedFrame, error) {
+	var f RecordedFrame
+
+	delta, err := binary.ReadUvarint(rr.reader)
+	if err != nil {
+		return f, err
+	}
+
+	ty, err := rr.reader.ReadByte()
+	if err != nil {
+		return f, io.ErrUnexpectedEOF
+	}
+
+	size, err := binary.ReadUvarint(rr.reader)
+	if err != nil {
+		return f, io.ErrUnexpectedEOF
+	}
+	if size > maxRecordedFrameSize {
+		return f, ErrInvalidRecording
+	}
+
+	switch ty {
+	case recordedTextFrame:
+	case recordedBinaryFrame:
+		f.Binary = true
+	default:
+		return f, ErrInvalidRecording
+	}
+
+	f.Data = make([]byte, size)
+	if _, err := io.ReadFull(rr.reader, f.Data); err != nil {
+		return f, io.ErrUnexpectedEOF
+	}
+
+	rr.offset += time.Duration(delta) * time.Microsecond
+	f.Time = rr.offset
+	return f, nil
+}
+
+func NewRecordingReader(reader io.Reader) (*RecordingReader, error) {
+	rr := &RecordingReader{reader: bufio.NewReader(reader)}
+
+	magic := make([]byte, len(recordingMagic))
+	if _, err := io.ReadFull(rr.reader, magic); err != nil || string(magic) != recordingMagic {
+		return nil, ErrInvalidRecording
+	}
+
+	var start int64
+	if err := binary.Read(rr.reader, binary.BigEndian, &start); err != nil {
+		return nil, ErrInvalidRecording
+	}
+
+	rr.start = time.Unix(0, start)
+	return rr, nil
+}
+
+// Replayer serves a recording as a fake engine websocket endpoint.
+// Every client that connects receives the full recording.
+type Replayer struct {
+	// Speed scales playback, 2 plays twice as fast as recorded.
+	// Zero or less sends all frames without delay.
+	Speed float64
+
+	frames  []RecordedFrame
+	handler websocket.Handler
+}
+
+func (rp *Replayer) Frames() []RecordedFrame {
+	return rp.frames
+}
+
+func (rp *Replayer) serveClient(ws *websocket.Conn) {
+	defer ws.Close()
+	go io.Copy(ioutil.Discard, ws)
+
+	start := time.Now()
+	for _, f := range rp.frames {
+		if rp.Speed > 0 {
+			due := start.Add(time.Duration(float64(f.Time) / rp.Speed))
+			time.Sleep(time.Until(due))
+		}
+
+		rf := rawFrame{f.Data, websocket.TextFrame}
+		if f.Binary {
+			rf.ty = websocket.BinaryFrame
+		}
+		if err := consoleRawFrameCodec.Send(ws, &rf); err != nil {
+			return
+		}
+	}
+}
+
+func (rp *Replayer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	rp.handler.ServeHTTP(w, req)
+}
+
+func NewReplayer(reader io.Reader) (*Replayer, error) {
+	rr, err := NewRecordingReader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	rp := &Replayer{Speed: 1}
+	rp.handler = websocket.Handler(rp.serveClient)
+
+	for {
+		f, err := rr.Next()
+		if err == io.EOF {
+			return rp, nil
+		} else if err != nil {
+			return nil, err
+		}
+		rp.frames = append(rp.frames, f)
+	}
+}
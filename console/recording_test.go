@@ -0,0 +1,160 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+func TestRecording(t *testing.T) {
+	var buf bytes.Buffer
+	rec, err := NewRecorder(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := rec.Start()
+	frames := []RecordedFrame{
+		{0, false, []byte(`{type="message"}`)},
+		{1500 * time.Microsecond, true, []byte{1, 2, 3, 0, 4}},
+		{time.Second, false, []byte{}},
+	}
+
+	for _, f := range frames {
+		if err := rec.WriteFrame(start.Add(f.Time), f.Binary, f.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rec.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	rr, err := NewRecordingReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range frames {
+		f, err := rr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(f, expected) {
+			t.Errorf("expected %v, got %v", expected, f)
+		}
+	}
+
+	if _, err := rr.Next(); err != io.EOF {
+		t.Error("expected end of recording")
+	}
+
+	if _, err := NewRecordingReader(strings.NewReader("garbage")); err != ErrInvalidRecording {
+		t.Error("expected invalid recording")
+	}
+
+	// A corrupt frame length is rejected before allocating.
+	header := buf.Bytes()[:len(recordingMagic)+8]
+	corrupt := append(append([]byte(nil), header...), 0, recordedBinaryFrame, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01)
+	if rr, err = NewRecordingReader(bytes.NewReader(corrupt)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rr.Next(); err != ErrInvalidRecording {
+		t.Errorf("expected invalid recording, got: %v", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var buf bytes.Buffer
+	rec, err := NewRecorder(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec.WriteFrame(time.Now(), false, []byte(`{type="script" script="test"}`))
+	rec.WriteFrame(time.Now(), true, []byte{42})
+	rec.Flush()
+
+	rp, err := NewReplayer(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp.Speed = 0
+
+	srv := httptest.NewServer(rp)
+	defer srv.Close()
+
+	con, err := NewConsole(strings.TrimPrefix(srv.URL, "http://"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Close()
+
+	var rerecorded bytes.Buffer
+	rec, _ = NewRecorder(&rerecorded)
+	con.Record(rec)
+
+	receiveAndTest(t, con, map[string]sjson.Value{"type": "script", "script": "test"})
+	if _, data, err := con.Receive(); err != nil || !bytes.Equal(data, []byte{42}) {
+		t.Error("expected binary frame")
+	}
+
+	rec.Flush()
+	rr, err := NewRecordingReader(&rerecorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range rp.Frames() {
+		f, err := rr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Binary != expected.Binary || !bytes.Equal(f.Data, expected.Data) {
+			t.Errorf("expected %v, got %v", expected, f)
+		}
+	}
+}
+
+func TestRecordWhileReceiving(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+
+	var buf bytes.Buffer
+	rec, _ := NewRecorder(&buf)
+
+	// Recording is started without any ordering against the read below.
+	done := make(chan struct{})
+	go func() {
+		con.Record(rec)
+		close(done)
+	}()
+
+	engine.Log("info", "Test", "message")
+	if _, err := con.ReceiveMessage(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+}
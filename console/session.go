@@ -0,0 +1,272 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+var ErrInvalidProfilerData = errors.New("invalid profiler data")
+
+// ResolvedEvent is a profiler event with its scope and thread names looked up.
+// Names not yet known to the session are formatted from their IDs.
+type ResolvedEvent struct {
+	ProfilerEvent
+	Scope,
+	Thread string
+}
+
+// ProfilerTables maps the string and thread IDs used by profiler events to names.
+type ProfilerTables struct {
+	lock    sync.RWMutex
+	strings map[uint64]string
+	threads map[uint32]string
+}
+
+// ProfilerSession keeps the string and thread tables sent by the engine
+// and uses them to resolve profiler events.
+type ProfilerSession struct {
+	*ProfilerTables
+
+	con     *Console
+	capture *CaptureWriter
+	events  []ProfilerEvent
+	frames  int
+
+	splitter *FrameSplitter
+	queue    []*ProfilerFrame
+}
+
+func parseTable(val sjson.Value, bits int) (map[uint64]string, error) {
+	table, ok := val.(map[string]sjson.Value)
+	if !ok {
+		return nil, ErrInvalidProfilerData
+	}
+
+	names := make(map[uint64]string, len(table))
+	for key, v := range table {
+		id, err := strconv.ParseUint(key, 10, bits)
+		if err != nil {
+			return nil, ErrInvalidProfilerData
+		}
+		if name, ok := v.(string); ok {
+			names[id] = name
+		}
+	}
+	return names, nil
+}
+
+// Ingest updates the string or thread table from a profiler_strings or
+// profiler_threads message. It returns false for any other value.
+func (s *ProfilerSession) Ingest(val sjson.Value) (bool, error) {
+	m, ok := val.(map[string]sjson.Value)
+	if !ok {
+		return false, nil
+	}
+
+	switch m["type"] {
+	case "profiler_strings":
+		names, err := parseTable(m["strings"], 64)
+		if err != nil {
+			return true, err
+		}
+		s.AddStrings(names)
+		if s.capture != nil {
+			return true, s.capture.AddStrings(names)
+		}
+		return true, nil
+	case "profiler_threads":
+		table, err := parseTable(m["threads"], 32)
+		if err != nil {
+			return true, err
+		}
+		names := make(map[uint32]string, len(table))
+		for id, name := range table {
+			names[uint32(id)] = name
+		}
+		s.AddThreads(names)
+		if s.capture != nil {
+			return true, s.capture.AddThreads(names)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// Capture writes all tables and events received by the session to cw.
+// Create cw with the session tables to include those already received.
+// Pass nil to stop capturing.
+func (s *ProfilerSession) Capture(cw *CaptureWriter) {
+	s.capture = cw
+}
+
+func (t *ProfilerTables) AddStrings(names map[uint64]string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for id, name := range names {
+		t.strings[id] = name
+	}
+}
+
+func (t *ProfilerTables) AddThreads(names map[uint32]string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for id, name := range names {
+		t.threads[id] = name
+	}
+}
+
+// Strings returns a copy of the string table.
+func (t *ProfilerTables) Strings() map[uint64]string {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	names := make(map[uint64]string, len(t.strings))
+	for id, name := range t.strings {
+		names[id] = name
+	}
+	return names
+}
+
+// Threads returns a copy of the thread table.
+func (t *ProfilerTables) Threads() map[uint32]string {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	names := make(map[uint32]string, len(t.threads))
+	for id, name := range t.threads {
+		names[id] = name
+	}
+	return names
+}
+
+// ScopeName returns the scope string for a ProfilerEvent.Name.
+func (t *ProfilerTables) ScopeName(id uint64) (string, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	name, ok := t.strings[id]
+	return name, ok
+}
+
+func (t *ProfilerTables) ThreadName(id uint32) (string, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	name, ok := t.threads[id]
+	return name, ok
+}
+
+func (t *ProfilerTables) Resolve(events []ProfilerEvent) []ResolvedEvent {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	resolved := make([]ResolvedEvent, len(events))
+	for i, ev := range events {
+		r := &resolved[i]
+		r.ProfilerEvent = ev
+
+		if name, ok := t.strings[ev.Name]; ok {
+			r.Scope = name
+		} else {
+			r.Scope = fmt.Sprintf("0x%x", ev.Name)
+		}
+		if name, ok := t.threads[ev.ThreadID]; ok {
+			r.Thread = name
+		} else {
+			r.Thread = fmt.Sprintf("thread %d", ev.ThreadID)
+		}
+	}
+	return resolved
+}
+
+// Next ingests string and thread tables until a batch of events is received,
+// and returns the batch resolved. Each batch is one binary frame from the engine,
+// other binary frames are skipped, and the parent, child and sibling links are indices into the batch.
+func (s *ProfilerSession) Next() ([]ResolvedEvent, error) {
+	for {
+		val, data, err := s.con.receive()
+		if err != nil {
+			return nil, err
+		}
+
+		if data != nil {
+			if !s.con.profilerData(data) {
+				continue
+			}
+			if s.events, err = decodeProfilerEvents(data, s.events); err != nil {
+				return nil, err
+			}
+			if s.capture != nil {
+				if err := s.capture.WriteFrame(s.events); err != nil {
+					return nil, err
+				}
+			}
+			return s.Resolve(s.events), nil
+		}
+
+		if _, err := s.Ingest(val); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// SplitFrames makes NextFrame group events into frames starting at each root
+// scope with the given name, using a FrameSplitter.
+func (s *ProfilerSession) SplitFrames(scope string) {
+	s.splitter = &FrameSplitter{Scope: scope}
+	s.queue = nil
+}
+
+// NextFrame returns the next frame of scope trees. Each batch is one frame,
+// unless SplitFrames has been called.
+func (s *ProfilerSession) NextFrame() (*ProfilerFrame, error) {
+	for len(s.queue) == 0 {
+		events, err := s.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		frame := BuildFrame(events)
+		if s.splitter == nil {
+			s.queue = append(s.queue, frame)
+		} else {
+			s.queue = s.splitter.Add(frame)
+		}
+	}
+
+	frame := s.queue[0]
+	s.queue = s.queue[1:]
+	frame.Index = s.frames
+	s.frames++
+	return frame, nil
+}
+
+func NewProfilerTables() *ProfilerTables {
+	return &ProfilerTables{
+		strings: make(map[uint64]string),
+		threads: make(map[uint32]string),
+	}
+}
+
+func NewProfilerSession(con *Console) *ProfilerSession {
+	return &ProfilerSession{ProfilerTables: NewProfilerTables(), con: con}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"testing"
+
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+func TestProfilerSession(t *testing.T) {
+	engine, con := startEngine(t)
+	defer engine.Close()
+	defer con.Close()
+
+	session := NewProfilerSession(con)
+
+	engine.SendProfilerStrings(map[uint64]string{1: "update", 2: "render"})
+	engine.SendProfilerThreads(map[uint32]string{7: "main"})
+	engine.SendBinary(map[string]sjson.Value{"type": "frame_capture"}, nil)
+	engine.SendProfilerEvents([]ProfilerEvent{
+		{Name: 1, ThreadID: 7, Parent: -1, FirstChild: 1, LastChild: 1, PrevSibling: -1, NextSibling: -1, Elapsed: 0.016, Count: 1},
+		{Name: 3, ThreadID: 8, Parent: 0, FirstChild: -1, LastChild: -1, PrevSibling: -1, NextSibling: -1, Time: 0.001, Elapsed: 0.01, Count: 1},
+	})
+
+	events, err := session.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if events[0].Scope != "update" || events[0].Thread != "main" || events[0].Elapsed != 0.016 {
+		t.Errorf("unexpected event: %+v", events[0])
+	}
+	if events[1].Scope != "0x3" || events[1].Thread != "thread 8" || events[1].Parent != 0 {
+		t.Errorf("unexpected event: %+v", events[1])
+	}
+
+	if name, ok := session.ScopeName(2); !ok || name != "render" {
+		t.Errorf("unexpected scope name: %s", name)
+	}
+	if _, ok := session.ThreadName(8); ok {
+		t.Error("unexpected thread name")
+	}
+}
+
+func TestProfilerSessionIngest(t *testing.T) {
+	session := NewProfilerSession(nil)
+
+	if ok, err := session.Ingest(map[string]sjson.Value{"type": "message"}); ok || err != nil {
+		t.Error("expected message to be ignored")
+	}
+
+	invalid := map[string]sjson.Value{"type": "profiler_threads", "threads": map[string]sjson.Value{"x": "main"}}
+	if ok, err := session.Ingest(invalid); !ok || err != ErrInvalidProfilerData {
+		t.Errorf("expected invalid data, got: %v", err)
+	}
+
+	if _, err := decodeProfilerEvents(make([]byte, 61), nil); err != ErrInvalidProfilerData {
+		t.Errorf("expected invalid data, got: %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"math"
+	"sort"
+)
+
+var StatsMetrics = []string{"min", "avg", "max", "p50", "p95", "p99"}
+
+// ScopeStats summarizes the time spent in a scope per frame, in seconds.
+// Frames where the scope did not appear are not included.
+type ScopeStats struct {
+	Scope  string
+	Frames int
+	Calls  int
+
+	Min, Avg, Max,
+	P50, P95, P99 float64
+}
+
+// Metric returns the value of one of StatsMetrics.
+func (s *ScopeStats) Metric(name string) (float64, bool) {
+	switch name {
+	case "min":
+		return s.Min, true
+	case "avg":
+		return s.Avg, true
+	case "max":
+		return s.Max, true
+	case "p50":
+		return s.P50, true
+	case "p95":
+		return s.P95, true
+	case "p99":
+		return s.P99, true
+	}
+	return 0, false
+}
+
+type scopeSamples struct {
+	times []float64
+	calls int
+}
+
+// StatsCollector aggregates scope times over frames. The time of a scope in
+// a frame is the sum of the inclusive times of all its calls, not counting
+// recursive calls twice.
+type StatsCollector struct {
+	scopes map[string]*scopeSamples
+	frames int
+}
+
+func (c *StatsCollector) Frames() int {
+	return c.frames
+}
+
+func (c *StatsCollector) AddFrame(frame *ProfilerFrame) {
+	c.frames++
+
+	times := make(map[string]float64)
+	active := make(map[string]int)
+
+	var visit func(s *Scope)
+	visit = func(s *Scope) {
+		name := s.Scope
+		if active[name] == 0 {
+			times[name] += s.Inclusive
+		}
+
+		samples, ok := c.scopes[name]
+		if !ok {
+			samples = &scopeSamples{}
+			c.scopes[name] = samples
+		}
+		samples.calls++
+
+		active[name]++
+		for _, child := range s.Children {
+			visit(child)
+		}
+		active[name]--
+	}
+
+	for _, t := range frame.Threads {
+		for _, root := range t.Roots {
+			visit(root)
+		}
+	}
+
+	for name, t := range times {
+		samples := c.scopes[name]
+		samples.times = append(samples.times, t)
+	}
+}
+
+// percentile uses the nearest rank method on sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// Stats returns the statistics for all scopes sorted by name.
+func (c *StatsCollector) Stats() []ScopeStats {
+	stats := make([]ScopeStats, 0, len(c.scopes))
+	for name, samples := range c.scopes {
+		sorted := append([]float64(nil), samples.times...)
+		sort.Float64s(sorted)
+
+		var sum float64
+		for _, t := range sorted {
+			sum += t
+		}
+
+		stats = append(stats, ScopeStats{
+			Scope:  name,
+			Frames: len(sorted),
+			Calls:  samples.calls,
+			Min:    sorted[0],
+			Avg:    sum / float64(len(sorted)),
+			Max:    sorted[len(sorted)-1],
+			P50:    percentile(sorted, 50),
+			P95:    percentile(sorted, 95),
+			P99:    percentile(sorted, 99),
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Scope < stats[j].Scope
+	})
+	return stats
+}
+
+func NewStatsCollector() *StatsCollector {
+	return &StatsCollector{scopes: make(map[string]*scopeSamples)}
+}
+
+// Tolerance is how much a metric may exceed its baseline.
+type Tolerance struct {
+	// Relative is a fraction of the baseline, 0.1 allows 10% over.
+	Relative float64
+	// Absolute is added to the limit, in seconds, so that short scopes
+	// do not fail on noise.
+	Absolute float64
+}
+
+func (t Tolerance) Limit(baseline float64) float64 {
+	return baseline*(1+t.Relative) + t.Absolute
+}
+
+type Regression struct {
+	Scope,
+	Metric string
+
+	Baseline,
+	Current,
+	Limit float64
+}
+
+// Compare returns the metrics of current that exceed the baseline s.
+func (s *ScopeStats) Compare(current *ScopeStats, metrics []string, tol Tolerance) []Regression {
+	var regressions []Regression
+	for _, m := range metrics {
+		base, ok := s.Metric(m)
+		if !ok {
+			continue
+		}
+
+		cur, _ := current.Metric(m)
+		if limit := tol.Limit(base); cur > limit {
+			regressions = append(regressions, Regression{s.Scope, m, base, cur, limit})
+		}
+	}
+	return regressions
+}
+
+// CompareStats compares every scope in baseline to current, and returns the
+// regressions and the names of baseline scopes missing from current.
+func CompareStats(baseline, current []ScopeStats, metrics []string, tol Tolerance) ([]Regression, []string) {
+	return CompareStatsFunc(baseline, current, metrics, func(string) Tolerance { return tol })
+}
+
+// CompareStatsFunc is like CompareStats, with the tolerance of each scope
+// returned by tol.
+func CompareStatsFunc(baseline, current []ScopeStats, metrics []string, tol func(scope string) Tolerance) ([]Regression, []string) {
+	scopes := make(map[string]*ScopeStats, len(current))
+	for i := range current {
+		scopes[current[i].Scope] = &current[i]
+	}
+
+	var (
+		regressions []Regression
+		missing     []string
+	)
+	for i := range baseline {
+		base := &baseline[i]
+		if cur, ok := scopes[base.Scope]; ok {
+			regressions = append(regressions, base.Compare(cur, metrics, tol(base.Scope))...)
+		} else {
+			missing = append(missing, base.Scope)
+		}
+	}
+	return regressions, missing
+}
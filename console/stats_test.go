@@ -0,0 +1,91 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/consoletest/profiletest"
+)
+
+func TestStatsCollector(t *testing.T) {
+	c := console.NewStatsCollector()
+	for i := 1; i <= 100; i++ {
+		events := []console.ResolvedEvent{
+			profiletest.Event("frame", "main", 1, -1, 0, 0.02),
+			profiletest.Event("update", "main", 1, 0, 0, float64(i)/1000),
+		}
+		if i%2 == 0 {
+			// Recursive calls are only counted once.
+			events = append(events, profiletest.Event("update", "main", 1, 1, 0, 0.0005))
+		}
+		c.AddFrame(console.BuildFrame(events))
+	}
+
+	stats := c.Stats()
+	if c.Frames() != 100 || len(stats) != 2 || stats[0].Scope != "frame" {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	update := stats[1]
+	if update.Frames != 100 || update.Calls != 150 {
+		t.Errorf("unexpected counts: %+v", update)
+	}
+	if update.Min != 0.001 || update.Max != 0.1 || update.P50 != 0.05 || update.P95 != 0.095 || update.P99 != 0.099 {
+		t.Errorf("unexpected times: %+v", update)
+	}
+	if !profiletest.AlmostEqual(update.Avg, 0.0505) {
+		t.Errorf("unexpected average: %v", update.Avg)
+	}
+}
+
+func TestCompareStats(t *testing.T) {
+	baseline := []console.ScopeStats{
+		{Scope: "render", Avg: 0.010, P95: 0.012},
+		{Scope: "update", Avg: 0.005, P95: 0.006},
+		{Scope: "removed", Avg: 0.001},
+	}
+	current := []console.ScopeStats{
+		{Scope: "render", Avg: 0.0109, P95: 0.014},
+		{Scope: "update", Avg: 0.004, P95: 0.006},
+	}
+
+	regressions, missing := console.CompareStats(baseline, current, []string{"avg", "p95", "bogus"}, console.Tolerance{Relative: 0.1})
+	if len(regressions) != 1 || regressions[0].Scope != "render" || regressions[0].Metric != "p95" {
+		t.Errorf("unexpected regressions: %+v", regressions)
+	}
+	if !reflect.DeepEqual(missing, []string{"removed"}) {
+		t.Errorf("unexpected missing scopes: %v", missing)
+	}
+
+	if regressions, _ := console.CompareStats(baseline, current, []string{"p95"}, console.Tolerance{Relative: 0.1, Absolute: 0.001}); len(regressions) != 0 {
+		t.Errorf("unexpected regressions: %+v", regressions)
+	}
+
+	regressions, _ = console.CompareStatsFunc(baseline, current, []string{"p95"}, func(scope string) console.Tolerance {
+		if scope == "render" {
+			return console.Tolerance{Relative: 0.2}
+		}
+		return console.Tolerance{}
+	})
+	if len(regressions) != 0 {
+		t.Errorf("unexpected regressions: %+v", regressions)
+	}
+}
@@ -0,0 +1,272 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package target implements a registry of named engine targets read from
+// a SJSON configuration file.
+//
+// Example configuration:
+//
+//	{
+//		targets = {
+//			devkit = {
+//				platform = "xb1"
+//				host = "10.0.0.12"
+//				level = "warning"
+//				exclude = ["Network"]
+//				scripts = ["print('hello')"]
+//			}
+//		}
+//	}
+package target
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+// EnvPath names the environment variable that overrides the default configuration path.
+const EnvPath = "STINGRAY_TARGETS"
+
+var platformPorts = map[string]int{
+	"pc":      console.DefaultPort,
+	"windows": console.DefaultPort,
+	"linux":   console.DefaultPort,
+	"macos":   console.DefaultPort,
+	"ps4":     console.DefaultPort,
+	"xb1":     console.DefaultXboxOnePort,
+	"xboxone": console.DefaultXboxOnePort,
+}
+
+type Target struct {
+	Name,
+	Platform,
+	Host string
+
+	// Log filter defaults.
+	Level,
+	Match string
+	Systems,
+	Exclude []string
+
+	// Scripts are sent to the engine after connecting.
+	Scripts []string
+}
+
+// Address returns host:port, using the platform default port if none is given.
+func (t *Target) Address() string {
+	if _, _, err := net.SplitHostPort(t.Host); err == nil {
+		return t.Host
+	}
+
+	port, ok := platformPorts[strings.ToLower(t.Platform)]
+	if !ok {
+		port = console.DefaultPort
+	}
+	return net.JoinHostPort(t.Host, strconv.Itoa(port))
+}
+
+// Filter returns the default log filter of the target, or nil if there is none.
+func (t *Target) Filter() (console.Filter, error) {
+	var filters []console.Filter
+
+	if t.Level != "" {
+		level, err := console.ParseLevel(t.Level)
+		if err != nil {
+			return nil, fmt.Errorf("invalid level: %s", t.Level)
+		}
+		filters = append(filters, console.MinLevel(level))
+	}
+	if len(t.Systems) > 0 {
+		filters = append(filters, console.IncludeSystems(t.Systems...))
+	}
+	if len(t.Exclude) > 0 {
+		filters = append(filters, console.ExcludeSystems(t.Exclude...))
+	}
+	if t.Match != "" {
+		re, err := regexp.Compile(t.Match)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, console.MatchText(re))
+	}
+
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	return console.And(filters...), nil
+}
+
+// Connect opens a console connection and runs the startup scripts.
+func (t *Target) Connect() (*console.Console, error) {
+	con, err := console.NewConsole(t.Address(), "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, script := range t.Scripts {
+		if err := con.SendCommand(console.Script, script); err != nil {
+			con.Close()
+			return nil, err
+		}
+	}
+	return con, nil
+}
+
+type Registry struct {
+	targets map[string]*Target
+}
+
+func (r *Registry) Lookup(name string) (*Target, error) {
+	if t, ok := r.targets[name]; ok {
+		return t, nil
+	}
+	return nil, fmt.Errorf("unknown target: %s", name)
+}
+
+func (r *Registry) Names() []string {
+	var names []string
+	for name := range r.targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func stringList(v sjson.Value) []string {
+	var list []string
+	for _, s := range v.([]sjson.Value) {
+		list = append(list, s.(string))
+	}
+	return list
+}
+
+func parseTarget(name string, v sjson.Value) *Target {
+	m := v.(map[string]sjson.Value)
+	t := &Target{Name: name}
+
+	t.Host, _ = m["host"].(string)
+	t.Platform, _ = m["platform"].(string)
+	t.Level, _ = m["level"].(string)
+	t.Match, _ = m["match"].(string)
+
+	if v, ok := m["systems"]; ok {
+		t.Systems = stringList(v)
+	}
+	if v, ok := m["exclude"]; ok {
+		t.Exclude = stringList(v)
+	}
+	if v, ok := m["scripts"]; ok {
+		t.Scripts = stringList(v)
+	}
+
+	if t.Host == "" {
+		t.Host = "localhost"
+	}
+	return t
+}
+
+func Load(reader io.Reader) (reg *Registry, err error) {
+	val, err := sjson.Decode(sjson.NewLexer(reader))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			reg, err = nil, errors.New("invalid target configuration")
+		}
+	}()
+
+	reg = &Registry{make(map[string]*Target)}
+	if val == nil {
+		return reg, nil
+	}
+
+	if targets, ok := val.(map[string]sjson.Value)["targets"]; ok {
+		for name, v := range targets.(map[string]sjson.Value) {
+			reg.targets[name] = parseTarget(name, v)
+		}
+	}
+	return reg, nil
+}
+
+func LoadFile(path string) (*Registry, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return Load(fp)
+}
+
+// DefaultPath returns the configuration path, $STINGRAY_TARGETS or
+// targets.sjson in the user configuration directory.
+func DefaultPath() string {
+	if p := os.Getenv(EnvPath); p != "" {
+		return p
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "targets.sjson"
+	}
+	return filepath.Join(dir, "stingray", "targets.sjson")
+}
+
+// Resolve looks up a target by name in the default configuration.
+func Resolve(name string) (*Target, error) {
+	reg, err := LoadFile(DefaultPath())
+	if err != nil {
+		return nil, err
+	}
+	return reg.Lookup(name)
+}
+
+// DefaultHost is used when neither a target nor a host is given.
+const DefaultHost = "localhost"
+
+// FromFlags returns the target of the -target and -host command line flags.
+// With no name it returns a target at host, otherwise the named target from
+// the default configuration, with its host replaced by host if not empty.
+func FromFlags(name, host string) (*Target, error) {
+	if name == "" {
+		if host == "" {
+			host = DefaultHost
+		}
+		return &Target{Host: host}, nil
+	}
+
+	tgt, err := Resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if host != "" {
+		tgt.Host = host
+	}
+	return tgt, nil
+}
@@ -0,0 +1,150 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package target
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/consoletest"
+	"github.com/andreas-jonsson/go-stingray/sjson"
+)
+
+const config = `{
+	// Comments are allowed.
+	targets = {
+		devkit = {platform = "xb1", host = "10.0.0.12", level = "warning", exclude = ["Network"]}
+		pc = {host = "localhost:4000", scripts = ["print('hello')"]}
+		local = {}
+	}
+}`
+
+func TestRegistry(t *testing.T) {
+	reg, err := Load(strings.NewReader(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := reg.Names(); !reflect.DeepEqual(names, []string{"devkit", "local", "pc"}) {
+		t.Errorf("unexpected targets: %v", names)
+	}
+
+	expected := map[string]string{"devkit": "10.0.0.12:4601", "pc": "localhost:4000", "local": "localhost:14030"}
+	for name, addr := range expected {
+		tgt, err := reg.Lookup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tgt.Address() != addr {
+			t.Errorf("%s: expected %s, got %s", name, addr, tgt.Address())
+		}
+	}
+
+	if _, err := reg.Lookup("missing"); err == nil {
+		t.Error("expected unknown target")
+	}
+
+	devkit, _ := reg.Lookup("devkit")
+	filter, err := devkit.Filter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.Match(console.Message{Level: console.LevelInfo}) || filter.Match(console.Message{Level: console.LevelError, System: "Network"}) {
+		t.Error("filter should reject message")
+	}
+	if !filter.Match(console.Message{Level: console.LevelError, System: "Lua"}) {
+		t.Error("filter should accept message")
+	}
+	if _, err := (&Target{Level: "warn"}).Filter(); err == nil {
+		t.Error("expected invalid level")
+	}
+
+	if _, err := Load(strings.NewReader(`{targets = []}`)); err == nil {
+		t.Error("expected invalid configuration")
+	}
+}
+
+func TestFromFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "targets.sjson")
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(EnvPath, path)
+	defer os.Unsetenv(EnvPath)
+
+	tests := []struct {
+		name, host, expected string
+	}{
+		{"", "", DefaultHost},
+		{"", "10.0.0.1", "10.0.0.1"},
+		{"devkit", "", "10.0.0.12"},
+		{"devkit", "10.0.0.1", "10.0.0.1"},
+	}
+	for _, test := range tests {
+		tgt, err := FromFlags(test.name, test.host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tgt.Host != test.expected {
+			t.Errorf("%q, %q: expected host %s, got %s", test.name, test.host, test.expected, tgt.Host)
+		}
+	}
+
+	if tgt, _ := FromFlags("devkit", "10.0.0.1"); tgt.Platform != "xb1" || tgt.Level != "warning" {
+		t.Errorf("unexpected target: %+v", tgt)
+	}
+	if _, err := FromFlags("missing", ""); err == nil {
+		t.Error("expected unknown target")
+	}
+}
+
+func TestConnect(t *testing.T) {
+	engine := consoletest.NewEngine()
+	defer engine.Close()
+
+	tgt := &Target{Host: engine.Addr(), Scripts: []string{"a()", "b()"}}
+	con, err := tgt.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Close()
+
+	if !engine.WaitForMessages(2, time.Second) {
+		t.Fatal("scripts not received")
+	}
+
+	expected := []sjson.Value{
+		map[string]sjson.Value{"type": "script", "script": "a()"},
+		map[string]sjson.Value{"type": "script", "script": "b()"},
+	}
+	if received := engine.Received(); !reflect.DeepEqual(received, expected) {
+		t.Errorf("unexpected messages: %v", received)
+	}
+}
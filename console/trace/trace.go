@@ -0,0 +1,172 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package trace writes profiler events in the Trace Event format
+// understood by chrome://tracing and Perfetto.
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+)
+
+const pid = 1
+
+var ErrClosed = errors.New("trace is closed")
+
+type event struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat,omitempty"`
+	Ph   string                 `json:"ph"`
+	Ts   float64                `json:"ts"`
+	Dur  *float64               `json:"dur,omitempty"`
+	Pid  int                    `json:"pid"`
+	Tid  uint32                 `json:"tid"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+func micros(seconds float64) float64 {
+	return seconds * 1e6
+}
+
+// Writer streams a trace. Thread metadata is written by Close, which must be
+// called to produce a valid file.
+type Writer struct {
+	// Process is the process name shown in the trace viewer.
+	Process string
+
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	threads map[uint32]string
+	count   int
+	closed  bool
+}
+
+func (w *Writer) write(ev *event) error {
+	if w.closed {
+		return ErrClosed
+	}
+
+	if w.count > 0 {
+		if err := w.writer.WriteByte(','); err != nil {
+			return err
+		}
+	}
+	w.count++
+	return w.encoder.Encode(ev)
+}
+
+// WriteEvents writes each event as a complete event. Names are expected to be
+// resolved, see console.ProfilerSession.
+func (w *Writer) WriteEvents(events []console.ResolvedEvent) error {
+	for _, ev := range events {
+		if _, ok := w.threads[ev.ThreadID]; !ok {
+			w.threads[ev.ThreadID] = ev.Thread
+		}
+
+		dur := micros(ev.Elapsed)
+		err := w.write(&event{
+			Name: ev.Scope,
+			Cat:  "scope",
+			Ph:   "X",
+			Ts:   micros(ev.Time),
+			Dur:  &dur,
+			Pid:  pid,
+			Tid:  ev.ThreadID,
+			Args: map[string]interface{}{"core": ev.CoreID, "count": ev.Count},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteFrame writes all scopes in the frame and a frame time counter.
+func (w *Writer) WriteFrame(frame *console.ProfilerFrame) error {
+	var events []console.ResolvedEvent
+	frame.Walk(func(s *console.Scope, depth int) bool {
+		events = append(events, s.ResolvedEvent)
+		return true
+	})
+
+	if err := w.WriteEvents(events); err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	return w.WriteCounter("frame time (ms)", frame.Start, map[string]float64{"ms": frame.Duration() * 1000})
+}
+
+// WriteCounter writes a counter event, t is in seconds.
+func (w *Writer) WriteCounter(name string, t float64, values map[string]float64) error {
+	args := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		args[k] = v
+	}
+	return w.write(&event{Name: name, Ph: "C", Ts: micros(t), Pid: pid, Args: args})
+}
+
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+
+	if w.Process != "" {
+		err := w.write(&event{Name: "process_name", Ph: "M", Pid: pid, Args: map[string]interface{}{"name": w.Process}})
+		if err != nil {
+			return err
+		}
+	}
+
+	ids := make([]uint32, 0, len(w.threads))
+	for id := range w.threads {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for i, id := range ids {
+		if err := w.write(&event{Name: "thread_name", Ph: "M", Pid: pid, Tid: id, Args: map[string]interface{}{"name": w.threads[id]}}); err != nil {
+			return err
+		}
+		if err := w.write(&event{Name: "thread_sort_index", Ph: "M", Pid: pid, Tid: id, Args: map[string]interface{}{"sort_index": i}}); err != nil {
+			return err
+		}
+	}
+
+	w.closed = true
+	if _, err := w.writer.WriteString("],\"displayTimeUnit\":\"ms\"}\n"); err != nil {
+		return err
+	}
+	return w.writer.Flush()
+}
+
+func NewWriter(writer io.Writer) (*Writer, error) {
+	w := &Writer{writer: bufio.NewWriter(writer), threads: make(map[uint32]string)}
+	w.encoder = json.NewEncoder(w.writer)
+
+	if _, err := w.writer.WriteString("{\"traceEvents\":[\n"); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
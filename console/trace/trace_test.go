@@ -0,0 +1,72 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/consoletest/profiletest"
+)
+
+func TestWriter(t *testing.T) {
+	events := []console.ResolvedEvent{
+		profiletest.Event("frame", "main", 1, -1, 0, 0.01),
+		profiletest.Event("update", "main", 1, 0, 0.001, 0.005),
+		profiletest.Event("job", "worker", 2, -1, 0.002, 0.003),
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Process = "game"
+
+	if err := w.WriteFrame(console.BuildFrame(events)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteEvents(events); err != ErrClosed {
+		t.Errorf("expected closed writer, got: %v", err)
+	}
+
+	var trace struct {
+		TraceEvents []event `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &trace); err != nil {
+		t.Fatal(err, buf.String())
+	}
+
+	phases := make(map[string]int)
+	for _, ev := range trace.TraceEvents {
+		phases[ev.Ph]++
+	}
+	if phases["X"] != 3 || phases["C"] != 1 || phases["M"] != 5 {
+		t.Errorf("unexpected events: %v", phases)
+	}
+
+	update := trace.TraceEvents[1]
+	if update.Name != "update" || update.Ts != 1000 || *update.Dur != 5000 || update.Tid != 1 {
+		t.Errorf("unexpected event: %+v", update)
+	}
+}
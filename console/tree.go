@@ -0,0 +1,311 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console
+
+import (
+	"math"
+	"sort"
+)
+
+// Scope is a node in a profiler scope tree. Times are in seconds.
+type Scope struct {
+	ResolvedEvent
+
+	Parent   *Scope
+	Children []*Scope
+
+	// Inclusive is the time spent in the scope, and Exclusive the part of it
+	// not spent in child scopes.
+	Inclusive,
+	Exclusive float64
+}
+
+// Path returns the scope names from the root down to s.
+func (s *Scope) Path() []string {
+	var n int
+	for p := s; p != nil; p = p.Parent {
+		n++
+	}
+
+	path := make([]string, n)
+	for p := s; p != nil; p = p.Parent {
+		n--
+		path[n] = p.Scope
+	}
+	return path
+}
+
+func (s *Scope) walk(depth int, fn func(s *Scope, depth int) bool) {
+	if fn(s, depth) {
+		for _, c := range s.Children {
+			c.walk(depth+1, fn)
+		}
+	}
+}
+
+// Walk calls fn for s and its descendants in depth first order.
+// Children are skipped if fn returns false.
+func (s *Scope) Walk(fn func(s *Scope, depth int) bool) {
+	s.walk(0, fn)
+}
+
+type ThreadTree struct {
+	ThreadID uint32
+	Thread   string
+	Roots    []*Scope
+}
+
+// ProfilerFrame is the scope trees built from one batch of profiler events.
+type ProfilerFrame struct {
+	// Index is the sequence number of the frame within a session.
+	Index int
+
+	Start,
+	End float64
+
+	// Threads is sorted by thread ID.
+	Threads []*ThreadTree
+}
+
+func (f *ProfilerFrame) Duration() float64 {
+	return f.End - f.Start
+}
+
+func (f *ProfilerFrame) Thread(id uint32) *ThreadTree {
+	for _, t := range f.Threads {
+		if t.ThreadID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// Walk calls fn for every scope in the frame, thread by thread.
+// Children are skipped if fn returns false.
+func (f *ProfilerFrame) Walk(fn func(s *Scope, depth int) bool) {
+	for _, t := range f.Threads {
+		for _, root := range t.Roots {
+			root.Walk(fn)
+		}
+	}
+}
+
+// FindFunc returns all scopes for which match returns true.
+func (f *ProfilerFrame) FindFunc(match func(s *Scope) bool) []*Scope {
+	var scopes []*Scope
+	f.Walk(func(s *Scope, depth int) bool {
+		if match(s) {
+			scopes = append(scopes, s)
+		}
+		return true
+	})
+	return scopes
+}
+
+// Find returns all scopes with the given name.
+func (f *ProfilerFrame) Find(name string) []*Scope {
+	return f.FindFunc(func(s *Scope) bool {
+		return s.Scope == name
+	})
+}
+
+func sortByTime(scopes []*Scope) {
+	sort.SliceStable(scopes, func(i, j int) bool {
+		return scopes[i].Time < scopes[j].Time
+	})
+}
+
+// parentIndices returns the parent of each event, or -1 for roots. Invalid
+// parents are replaced by -1, and so is the parent of one event in each cycle.
+func parentIndices(events []ResolvedEvent) []int {
+	parents := make([]int, len(events))
+	for i, ev := range events {
+		parents[i] = -1
+		if p := int(ev.Parent); p >= 0 && p < len(events) {
+			parents[i] = p
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make([]byte, len(events))
+	var chain []int
+	for i := range events {
+		chain = chain[:0]
+		j := i
+		for state[j] == unvisited {
+			state[j] = visiting
+			chain = append(chain, j)
+			if parents[j] < 0 {
+				break
+			}
+			j = parents[j]
+		}
+
+		// Reaching an event on the current chain again means the last
+		// event links back into it.
+		if state[j] == visiting && parents[j] >= 0 && parents[chain[len(chain)-1]] == j {
+			parents[chain[len(chain)-1]] = -1
+		}
+		for _, k := range chain {
+			state[k] = visited
+		}
+	}
+	return parents
+}
+
+// BuildFrame reconstructs the scope trees from one batch of events, using the
+// parent index of each event. Events with invalid parents, or parents that
+// form a cycle, become roots. Children are ordered by start time.
+func BuildFrame(events []ResolvedEvent) *ProfilerFrame {
+	frame := &ProfilerFrame{Start: math.Inf(1), End: math.Inf(-1)}
+	if len(events) == 0 {
+		frame.Start, frame.End = 0, 0
+		return frame
+	}
+
+	scopes := make([]Scope, len(events))
+	parents := parentIndices(events)
+	threads := make(map[uint32]*ThreadTree)
+
+	for i, ev := range events {
+		s := &scopes[i]
+		s.ResolvedEvent = ev
+		s.Inclusive = ev.Elapsed
+		s.Exclusive = ev.Elapsed
+
+		frame.Start = math.Min(frame.Start, ev.Time)
+		frame.End = math.Max(frame.End, ev.Time+ev.Elapsed)
+
+		if p := parents[i]; p >= 0 {
+			parent := &scopes[p]
+			s.Parent = parent
+			parent.Children = append(parent.Children, s)
+			continue
+		}
+
+		t, ok := threads[ev.ThreadID]
+		if !ok {
+			t = &ThreadTree{ThreadID: ev.ThreadID, Thread: ev.Thread}
+			threads[ev.ThreadID] = t
+			frame.Threads = append(frame.Threads, t)
+		}
+		t.Roots = append(t.Roots, s)
+	}
+
+	for i := range scopes {
+		s := &scopes[i]
+		sortByTime(s.Children)
+		for _, c := range s.Children {
+			s.Exclusive -= c.Inclusive
+		}
+		if s.Exclusive < 0 {
+			s.Exclusive = 0
+		}
+	}
+
+	for _, t := range frame.Threads {
+		sortByTime(t.Roots)
+	}
+	sort.Slice(frame.Threads, func(i, j int) bool {
+		return frame.Threads[i].ThreadID < frame.Threads[j].ThreadID
+	})
+	return frame
+}
+
+type splitRoot struct {
+	thread *ThreadTree
+	scope  *Scope
+}
+
+// FrameSplitter regroups the scope trees of batches into frames that start
+// at each root scope named Scope, for engines that do not send one batch per
+// frame. A tree belongs to the frame its root starts in, and trees received
+// before the first frame boundary are discarded.
+type FrameSplitter struct {
+	Scope string
+
+	pending []splitRoot
+	start   float64
+	started bool
+}
+
+func (fs *FrameSplitter) build(roots []splitRoot) *ProfilerFrame {
+	frame := &ProfilerFrame{Start: math.Inf(1), End: math.Inf(-1)}
+	threads := make(map[uint32]*ThreadTree)
+
+	for _, r := range roots {
+		frame.Start = math.Min(frame.Start, r.scope.Time)
+		frame.End = math.Max(frame.End, r.scope.Time+r.scope.Elapsed)
+
+		t, ok := threads[r.thread.ThreadID]
+		if !ok {
+			t = &ThreadTree{ThreadID: r.thread.ThreadID, Thread: r.thread.Thread}
+			threads[t.ThreadID] = t
+			frame.Threads = append(frame.Threads, t)
+		}
+		t.Roots = append(t.Roots, r.scope)
+	}
+
+	sort.Slice(frame.Threads, func(i, j int) bool {
+		return frame.Threads[i].ThreadID < frame.Threads[j].ThreadID
+	})
+	return frame
+}
+
+// Add adds the trees of one batch and returns the frames completed by it.
+// A frame is complete once the root starting the next frame is received.
+func (fs *FrameSplitter) Add(batch *ProfilerFrame) []*ProfilerFrame {
+	for _, t := range batch.Threads {
+		for _, root := range t.Roots {
+			fs.pending = append(fs.pending, splitRoot{t, root})
+		}
+	}
+	sort.SliceStable(fs.pending, func(i, j int) bool {
+		return fs.pending[i].scope.Time < fs.pending[j].scope.Time
+	})
+
+	var frames []*ProfilerFrame
+	for {
+		next := -1
+		for i, r := range fs.pending {
+			if r.scope.Scope == fs.Scope && (!fs.started || r.scope.Time > fs.start) {
+				next = i
+				break
+			}
+		}
+
+		if next < 0 {
+			if !fs.started {
+				fs.pending = fs.pending[:0]
+			}
+			return frames
+		}
+
+		if fs.started {
+			frames = append(frames, fs.build(fs.pending[:next]))
+		}
+		fs.pending = append([]splitRoot(nil), fs.pending[next:]...)
+		fs.start = fs.pending[0].scope.Time
+		fs.started = true
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package console_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/andreas-jonsson/go-stingray/console"
+	"github.com/andreas-jonsson/go-stingray/console/consoletest/profiletest"
+)
+
+// testFrameEvents is one frame with a main thread running update and render,
+// and a worker thread running one render job.
+func testFrameEvents() []console.ResolvedEvent {
+	return []console.ResolvedEvent{
+		profiletest.Event("frame", "main", 1, -1, 0, 10),
+		profiletest.Event("render", "main", 1, 0, 6, 3),
+		profiletest.Event("update", "main", 1, 0, 1, 4),
+		profiletest.Event("script", "main", 1, 2, 2, 2),
+		profiletest.Event("render", "worker", 2, -1, 6.5, 2),
+	}
+}
+
+func TestBuildFrame(t *testing.T) {
+	frame := console.BuildFrame(testFrameEvents())
+
+	if frame.Start != 0 || frame.End != 10 || frame.Duration() != 10 {
+		t.Errorf("unexpected frame time: %v - %v", frame.Start, frame.End)
+	}
+	if len(frame.Threads) != 2 || frame.Threads[0].Thread != "main" || frame.Thread(2).Thread != "worker" {
+		t.Fatalf("unexpected threads: %+v", frame.Threads)
+	}
+
+	root := frame.Thread(1).Roots[0]
+	if len(root.Children) != 2 || root.Children[0].Scope != "update" || root.Children[1].Scope != "render" {
+		t.Fatalf("unexpected children: %+v", root.Children)
+	}
+	if !profiletest.AlmostEqual(root.Inclusive, 10) || !profiletest.AlmostEqual(root.Exclusive, 3) {
+		t.Errorf("unexpected root times: %v %v", root.Inclusive, root.Exclusive)
+	}
+
+	update := root.Children[0]
+	if !profiletest.AlmostEqual(update.Exclusive, 2) {
+		t.Errorf("unexpected exclusive time: %v", update.Exclusive)
+	}
+	if path := update.Children[0].Path(); !reflect.DeepEqual(path, []string{"frame", "update", "script"}) {
+		t.Errorf("unexpected path: %v", path)
+	}
+
+	var visited []string
+	frame.Walk(func(s *console.Scope, depth int) bool {
+		visited = append(visited, s.Scope)
+		return s.Scope != "update"
+	})
+	if !reflect.DeepEqual(visited, []string{"frame", "update", "render", "render"}) {
+		t.Errorf("unexpected walk order: %v", visited)
+	}
+
+	render := frame.Find("render")
+	if len(render) != 2 || render[0].Thread != "main" || render[1].Thread != "worker" {
+		t.Errorf("unexpected scopes: %+v", render)
+	}
+}
+
+func TestBuildFrameInvalidLinks(t *testing.T) {
+	events := []console.ResolvedEvent{
+		profiletest.Event("a", "main", 1, 0, 0, 1),
+		profiletest.Event("b", "main", 1, 5, 0, 1),
+	}
+
+	frame := console.BuildFrame(events)
+	if len(frame.Threads) != 1 || len(frame.Threads[0].Roots) != 2 {
+		t.Errorf("expected invalid parents to become roots: %+v", frame.Threads)
+	}
+
+	if empty := console.BuildFrame(nil); empty.Duration() != 0 || len(empty.Threads) != 0 {
+		t.Errorf("unexpected empty frame: %+v", empty)
+	}
+}
+
+func TestBuildFrameCycle(t *testing.T) {
+	events := []console.ResolvedEvent{
+		profiletest.Event("a", "main", 1, 2, 0, 3),
+		profiletest.Event("b", "main", 1, 0, 1, 1),
+		profiletest.Event("c", "main", 1, 1, 1.5, 0.5),
+		profiletest.Event("d", "main", 1, 3, 4, 1),
+	}
+
+	frame := console.BuildFrame(events)
+
+	var visited []string
+	frame.Walk(func(s *console.Scope, depth int) bool {
+		visited = append(visited, s.Scope)
+		return true
+	})
+	if len(visited) != len(events) {
+		t.Fatalf("events dropped: %v", visited)
+	}
+
+	roots := frame.Threads[0].Roots
+	if len(roots) != 2 || roots[0].Scope != "b" || roots[1].Scope != "d" {
+		t.Fatalf("unexpected roots: %+v", roots)
+	}
+	if path := frame.Find("a")[0].Path(); !reflect.DeepEqual(path, []string{"b", "c", "a"}) {
+		t.Errorf("unexpected path: %v", path)
+	}
+}
+
+func TestFrameSplitter(t *testing.T) {
+	fs := &console.FrameSplitter{Scope: "frame"}
+
+	batch := func(events ...console.ResolvedEvent) *console.ProfilerFrame {
+		return console.BuildFrame(events)
+	}
+	names := func(frame *console.ProfilerFrame) []string {
+		var names []string
+		for _, th := range frame.Threads {
+			for _, root := range th.Roots {
+				names = append(names, th.Thread+":"+root.Scope)
+			}
+		}
+		return names
+	}
+
+	frames := fs.Add(batch(
+		profiletest.Event("loading", "main", 1, -1, 0, 0.5),
+		profiletest.Event("frame", "main", 1, -1, 1, 1.5),
+		profiletest.Event("update", "main", 1, 1, 1, 1),
+		profiletest.Event("job", "worker", 2, -1, 1.5, 0.5),
+	))
+	if len(frames) != 0 {
+		t.Fatalf("unexpected frames: %d", len(frames))
+	}
+
+	frames = fs.Add(batch(
+		profiletest.Event("frame", "main", 1, -1, 3, 1),
+		profiletest.Event("job", "worker", 2, -1, 2.5, 0.5),
+		profiletest.Event("job", "worker", 2, -1, 3.5, 0.5),
+	))
+	if len(frames) != 1 {
+		t.Fatalf("unexpected frames: %d", len(frames))
+	}
+	if n := names(frames[0]); !reflect.DeepEqual(n, []string{"main:frame", "worker:job", "worker:job"}) {
+		t.Errorf("unexpected roots: %v", n)
+	}
+	if frames[0].Start != 1 || frames[0].End != 3 || len(frames[0].Thread(1).Roots[0].Children) != 1 {
+		t.Errorf("unexpected frame: %+v", frames[0])
+	}
+
+	// Trees arriving after their frame was returned go to the next frame.
+	frames = fs.Add(batch(
+		profiletest.Event("frame", "main", 1, -1, 5, 1),
+		profiletest.Event("job", "worker", 2, -1, 2.8, 0.1),
+	))
+	if len(frames) != 1 {
+		t.Fatalf("unexpected frames: %d", len(frames))
+	}
+	if n := names(frames[0]); !reflect.DeepEqual(n, []string{"main:frame", "worker:job", "worker:job"}) {
+		t.Errorf("unexpected roots: %v", n)
+	}
+	if frames[0].Start != 2.8 || frames[0].End != 4 {
+		t.Errorf("unexpected frame time: %v - %v", frames[0].Start, frames[0].End)
+	}
+}
@@ -21,6 +21,9 @@ package sjson
 func Decode(lex *Lexer) (Value, error) {
 	lex.err = nil
 	lex.parseResult = nil
-	yyParse(lex)
+	if lex.parser == nil {
+		lex.parser = yyNewParser()
+	}
+	lex.parser.Parse(lex)
 	return lex.parseResult, lex.err
 }
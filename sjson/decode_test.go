@@ -18,8 +18,10 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package sjson
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -48,3 +50,61 @@ func TestDecode(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestLexerReset(t *testing.T) {
+	lex := NewLexer(strings.NewReader(`{a = "first" b = 1`))
+	if _, err := Decode(lex); err == nil {
+		t.Fatal("expected error")
+	}
+
+	lex.Reset(strings.NewReader(`{a = "line\nbreak" b_2 = [1, true, null]}`))
+	v, err := Decode(lex)
+	if err != nil {
+		t.Fatal(lex, err)
+	}
+
+	m := v.(map[string]Value)
+	if m["a"] != "line\nbreak" || len(m["b_2"].([]Value)) != 3 {
+		t.Errorf("unexpected value: %v", v)
+	}
+}
+
+func TestLexerResetBytes(t *testing.T) {
+	lex := NewLexer(strings.NewReader(""))
+
+	data := []byte("{a = \"line\\nbreak\" /* comment */ b = [1, true, null] // end\n c = \"\u00e5\u00e4\u00f6\"}\x00payload")
+	lex.ResetBytes(data)
+	v, err := Decode(lex)
+	if err != nil {
+		t.Fatal(lex, err)
+	}
+
+	m := v.(map[string]Value)
+	if m["a"] != "line\nbreak" || len(m["b"].([]Value)) != 3 || m["c"] != "\u00e5\u00e4\u00f6" {
+		t.Errorf("unexpected value: %v", v)
+	}
+	if n := lex.Offset(); data[n] != 0 {
+		t.Errorf("unexpected offset: %d", n)
+	}
+
+	lex.ResetBytes([]byte(`{a = 1`))
+	if _, err := Decode(lex); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	data := []byte(`{type = "message" system = "Lua" level = "info" message_type = "log" message = "hello \"world\""}`)
+	reader := bytes.NewReader(data)
+	lex := NewLexer(reader)
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		reader.Reset(data)
+		lex.Reset(reader)
+		if _, err := Decode(lex); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
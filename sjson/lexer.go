@@ -23,24 +23,99 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"regexp"
 	"strconv"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
-var identifierPattern = regexp.MustCompile("[_a-zA-Z][_a-zA-Z0-9]*")
+// source is implemented by bufio.Reader and sliceReader.
+type source interface {
+	io.RuneScanner
+	io.ByteReader
+	ReadString(delim byte) (string, error)
+	Peek(n int) ([]byte, error)
+}
+
+// sliceReader reads directly from a byte slice.
+type sliceReader struct {
+	data []byte
+	pos  int
+	// last is the size of the last rune read, or zero if it can not be unread.
+	last int
+}
+
+func (r *sliceReader) ReadByte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, io.EOF
+	}
+	c := r.data[r.pos]
+	r.pos++
+	r.last = 0
+	return c, nil
+}
+
+func (r *sliceReader) ReadRune() (rune, int, error) {
+	if r.pos >= len(r.data) {
+		r.last = 0
+		return 0, 0, io.EOF
+	}
+
+	c, size := rune(r.data[r.pos]), 1
+	if c >= utf8.RuneSelf {
+		c, size = utf8.DecodeRune(r.data[r.pos:])
+	}
+	r.pos += size
+	r.last = size
+	return c, size, nil
+}
+
+func (r *sliceReader) UnreadRune() error {
+	if r.last == 0 {
+		return bufio.ErrInvalidUnreadRune
+	}
+	r.pos -= r.last
+	r.last = 0
+	return nil
+}
+
+func (r *sliceReader) ReadString(delim byte) (string, error) {
+	r.last = 0
+	data := r.data[r.pos:]
+	if i := bytes.IndexByte(data, delim); i >= 0 {
+		r.pos += i + 1
+		return string(data[:i+1]), nil
+	}
+	r.pos = len(r.data)
+	return string(data), io.EOF
+}
+
+func (r *sliceReader) Peek(n int) ([]byte, error) {
+	if r.pos+n > len(r.data) {
+		return r.data[r.pos:], io.EOF
+	}
+	return r.data[r.pos : r.pos+n], nil
+}
 
 type Lexer struct {
-	reader      *bufio.Reader
+	// src is either reader or slice.
+	src    source
+	reader *bufio.Reader
+	slice  sliceReader
+
 	err         error
 	parseResult Value
 
+	// buf and parser are reused for every token and value.
+	buf    bytes.Buffer
+	parser yyParser
+
 	line, col int
 	char      byte
 }
 
 func (lex *Lexer) nextRune() (rune, error) {
-	r, _, err := lex.reader.ReadRune()
+	r, _, err := lex.src.ReadRune()
 	if err != nil {
 		return r, err
 	}
@@ -57,7 +132,7 @@ func (lex *Lexer) nextRune() (rune, error) {
 }
 
 func (lex *Lexer) nextChar() (byte, error) {
-	c, err := lex.reader.ReadByte()
+	c, err := lex.src.ReadByte()
 	if err != nil {
 		return c, err
 	}
@@ -93,7 +168,7 @@ func (lex *Lexer) consumeComment() error {
 
 	switch c {
 	case '/':
-		if _, err := lex.reader.ReadString('\n'); err != nil {
+		if _, err := lex.src.ReadString('\n'); err != nil {
 			return err
 		}
 		lex.line++
@@ -106,13 +181,13 @@ func (lex *Lexer) consumeComment() error {
 				return err
 			}
 			if r == '*' {
-				buf, err := lex.reader.Peek(1)
+				buf, err := lex.src.Peek(1)
 				if err != nil {
 					return err
 				}
 				if buf[0] == '/' {
 					lex.col++
-					_, err := lex.reader.ReadByte()
+					_, err := lex.src.ReadByte()
 					return err
 				}
 			}
@@ -131,15 +206,41 @@ func identifierTermination(r rune) bool {
 	}
 }
 
+func identifierChar(c byte, first bool) bool {
+	switch {
+	case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	case c >= '0' && c <= '9':
+		return !first
+	default:
+		return false
+	}
+}
+
+// maybeNumber avoids the cost of a failed ParseFloat for most identifiers.
+func maybeNumber(ident string) bool {
+	if !identifierChar(ident[0], true) {
+		return true
+	}
+	switch strings.ToLower(ident) {
+	case "inf", "infinity", "nan":
+		return true
+	}
+	return false
+}
+
 func validateIdentifier(ident string) error {
-	if len(identifierPattern.Find([]byte(ident))) == len(ident) {
-		return nil
+	for i := 0; i < len(ident); i++ {
+		if !identifierChar(ident[i], i == 0) {
+			return fmt.Errorf("invalid identifier '%s'", ident)
+		}
 	}
-	return fmt.Errorf("invalid identifier '%s'", ident)
+	return nil
 }
 
 func (lex *Lexer) readIdentifier(initial byte) (string, error) {
-	var buf bytes.Buffer
+	buf := &lex.buf
+	buf.Reset()
 	if err := buf.WriteByte(initial); err != nil {
 		return "", err
 	}
@@ -151,7 +252,7 @@ func (lex *Lexer) readIdentifier(initial byte) (string, error) {
 		}
 
 		if identifierTermination(r) {
-			if err := lex.reader.UnreadRune(); err != nil {
+			if err := lex.src.UnreadRune(); err != nil {
 				return "", err
 			}
 			return buf.String(), nil
@@ -164,7 +265,10 @@ func (lex *Lexer) readIdentifier(initial byte) (string, error) {
 }
 
 func (lex *Lexer) readString() (string, error) {
-	var buf bytes.Buffer
+	buf := &lex.buf
+	buf.Reset()
+
+	escaped := false
 	for {
 		r, err := lex.nextRune()
 		if err != nil {
@@ -172,6 +276,7 @@ func (lex *Lexer) readString() (string, error) {
 		}
 
 		if r == '\\' {
+			escaped = true
 			if _, err := buf.WriteRune(r); err != nil {
 				return "", nil
 			}
@@ -185,7 +290,16 @@ func (lex *Lexer) readString() (string, error) {
 				return "", nil
 			}
 		} else if r == '"' {
-			return strconv.Unquote(fmt.Sprintf("\"%s\"", buf.String()))
+			if !escaped && bytes.IndexByte(buf.Bytes(), '\n') < 0 {
+				return buf.String(), nil
+			}
+
+			var quoted strings.Builder
+			quoted.Grow(buf.Len() + 2)
+			quoted.WriteByte('"')
+			quoted.Write(buf.Bytes())
+			quoted.WriteByte('"')
+			return strconv.Unquote(quoted.String())
 		} else {
 			if _, err := buf.WriteRune(r); err != nil {
 				return "", nil
@@ -245,10 +359,11 @@ start:
 		return 0
 	}
 
-	f, err := strconv.ParseFloat(ident, 64)
-	if err == nil {
-		lval.v = f
-		return _NUMBER
+	if maybeNumber(ident) {
+		if f, err := strconv.ParseFloat(ident, 64); err == nil {
+			lval.v = f
+			return _NUMBER
+		}
 	}
 
 	switch ident {
@@ -272,6 +387,8 @@ start:
 	return _IDENTIFIER
 }
 
+// Reader returns the buffered reader wrapping the reader passed to NewLexer
+// or Reset. It is not used while reading from a slice set by ResetBytes.
 func (lex *Lexer) Reader() *bufio.Reader {
 	return lex.reader
 }
@@ -282,11 +399,40 @@ func (lex *Lexer) Error(s string) {
 	}
 }
 
+// Reset discards any buffered data and makes the lexer read from reader,
+// reusing its buffers. It is cheaper than creating a new lexer.
+func (lex *Lexer) Reset(reader io.Reader) {
+	lex.reset()
+	lex.reader.Reset(reader)
+	lex.src = lex.reader
+}
+
+// ResetBytes makes the lexer read directly from data, without copying it.
+func (lex *Lexer) ResetBytes(data []byte) {
+	lex.reset()
+	lex.slice = sliceReader{data: data}
+	lex.src = &lex.slice
+}
+
+// Offset returns the number of bytes read from the slice set by ResetBytes.
+func (lex *Lexer) Offset() int {
+	return lex.slice.pos
+}
+
+func (lex *Lexer) reset() {
+	lex.err = nil
+	lex.parseResult = nil
+	lex.line = 1
+	lex.col = 1
+	lex.char = 0
+}
+
 // NewLexer initializes a new lexer that can be used with Decode.
 func NewLexer(reader io.Reader) *Lexer {
 	lex := new(Lexer)
 	lex.line = 1
 	lex.col = 1
 	lex.reader = bufio.NewReader(reader)
+	lex.src = lex.reader
 	return lex
 }